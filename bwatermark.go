@@ -4,12 +4,14 @@ import (
 	"blindwatermark/converter"
 	"blindwatermark/core"
 	"bytes"
+	"crypto/ed25519"
 	"encoding/binary"
 	"fmt"
 	"image"
 	"image/color"
 	"image/jpeg"
 	"image/png"
+	"log/slog"
 	"math"
 	"os"
 
@@ -20,42 +22,126 @@ import (
 
 type BlindWatermarker struct {
 	engine *core.Engine
+
+	// FEC 纠错编码，nil 表示不使用。编码方案和冗余等级会写入头部，提取时自动识别
+	// 例如 converter.NewReedSolomon(2) 或 converter.NewConvolutional()
+	FEC converter.Codec
+
+	// EncryptionKey AES 密钥 (16 / 24 / 32 字节)，非空时载荷经过 AES-GCM 认证加密，
+	// 提取加密水印时也需要同一个密钥。加密会额外占用 converter.SealOverhead 字节
+	EncryptionKey []byte
+
+	// SigningKey Ed25519 私钥，非空时载荷末尾附带签名 (额外占用 converter.SignatureOverhead 字节)，
+	// 持有公钥的第三方可以用 VerifyExtract 验证水印来源，但无法伪造
+	SigningKey ed25519.PrivateKey
+
+	// CompactHeader 使用紧凑头部 (4 bit 类型 + 变长长度)，短载荷可节省 4 字节，
+	// 适合容量很小的缩略图。提取时自动识别，无需额外设置
+	CompactHeader bool
+	// Compress 嵌入前用 DEFLATE 压缩数据，只在压缩后确实变短时生效
+	Compress bool
+	// Stream 引擎设置了 TileSize 时，Embed* 返回按需嵌入的图片 (见 core.Engine.EmbedStream)，
+	// 直接交给 png.Encode / jpeg.Encode 时输出只占一行分块的内存，适合超大图片
+	Stream bool
+	// TargetPSNR 目标 PSNR (dB)，大于 0 时按实际画质调整嵌入强度，使输出与原图的 PSNR 接近该值。
+	// 强度在引擎 Strength 的 1/4 到 4 倍之间搜索，每次嵌入多做几遍完整的嵌入。
+	// 提取端仍按引擎的 Strength 归一化，软判决值整体缩放，不影响解码。
+	// QIM / STDM 模式提取时需要原样的步长，不能与此项同时使用，应按 JPEG 质量选择步长 (core.Engine.StepForQuality)
+	TargetPSNR float64
+	// WaveletSearch 用配置的小波解不出水印时，依次换用其他内置小波重试 (core.Wavelets)。
+	// 小波基不写入图片，默认只用引擎配置的小波提取；不知道嵌入端用的是哪种小波时才开启，
+	// 没有水印的图片要多做几遍完整的提取
+	WaveletSearch bool
+
+	// Logger 记录容量、载荷大小、水印图片缩放、数据不完整等诊断事件，nil 表示不输出。
+	// 常规过程为 Debug 级别，自动缩放水印图片为 Info，提取到的数据有缺损时为 Warn
+	Logger *slog.Logger
+}
+
+// NewBlindWatermarker 使用默认参数创建 BlindWatermarker，opts 按顺序调整各项设置 (见 options.go)，
+// 例如 NewBlindWatermarker(WithStrength(30), WithLevels(2), WithKey(key))。
+// 选项的组合是否合理可以用 Validate 检查，嵌入和提取时也会检查
+func NewBlindWatermarker(opts ...Option) *BlindWatermarker {
+	b := &BlindWatermarker{
+		engine: &core.Engine{
+			Strength: 20.0, // 强度越大越抗干扰，但画质损失越大
+			Refine:   2,    // 嵌入后校验，补嵌高光、暗部被截断削弱的位
+			// 几何同步模板默认不嵌入：它本身就让 PSNR 降到 42 dB 左右，只有需要 ExtractResync 时才值得，见 WithSyncStrength
+		},
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// NewBlindWatermarkerWithEngine 使用自定义的引擎参数 (子带、冗余嵌入等) 创建 BlindWatermarker
+func NewBlindWatermarkerWithEngine(engine *core.Engine) *BlindWatermarker {
+	return &BlindWatermarker{engine: engine}
 }
 
-func NewBlindWatermarker() *BlindWatermarker {
-	return &BlindWatermarker{
-		engine: &core.Engine{Strength: 20.0}, // 强度越大越抗干扰，但画质损失越大
+// logger 诊断事件的输出，未设置 Logger 时丢弃
+func (b *BlindWatermarker) logger() *slog.Logger {
+	if b.Logger == nil {
+		return discardLogger
 	}
+	return b.Logger
 }
 
+var discardLogger = slog.New(slog.DiscardHandler)
+
 // Result 提取结果
 type Result struct {
 	Type        converter.WatermarkType
 	TextContent string
 	ImageBytes  []byte // 如果是图片或二维码，存储原始字节
+	Encrypted   bool   // 载荷是否经过加密 (已通过认证并解密)
+	Signed      bool   // 载荷是否附带签名，签名是否有效需调用 VerifyExtract 校验
+	Signature   []byte // Ed25519 签名
+
+	// Confidence 整体置信度 [0, 1]：0 相当于随机猜测，1 表示每一位都非常可靠
+	// 由各位 (冗余模式下为表决后) 的软判决值按高斯信道模型换算而来
+	Confidence float64
+	// BitErrorRate 估计的信道误码率：把解出的内容按原方式重新编码，
+	// 与提取出的原始比特 (纠错、表决之前) 逐位比对得到
+	BitErrorRate float64
 }
 
 // 1. 嵌入字符串
 func (b *BlindWatermarker) EmbedText(src image.Image, text string) (image.Image, error) {
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
 	// Pack: [Type:Text] [Len] [TextData]
-	bits := converter.Pack(converter.TypeText, []byte(text))
+	bits, err := b.pack(converter.TypeText, []byte(text))
+	if err != nil {
+		return nil, err
+	}
 	return b.embed(src, bits)
 }
 
-// EmbedImage 3. 嵌入图片水印
-// watermark.go
-
-// 3. 嵌入图片水印 (优化版：转为 1-bit 二值化数据存储)
-// 3. 嵌入图片水印 (支持动态尺寸)
+// EmbedImage 3. 嵌入图片水印 (二值化后按 1 bit / 像素存储，超出容量时自动缩小)
 func (b *BlindWatermarker) EmbedImage(src image.Image, wmImage image.Image) (image.Image, error) {
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	if err := b.checkSize(src); err != nil {
+		return nil, err
+	}
 	wmImage = ConvertToGray(wmImage)
 	// --- 新增逻辑：检查容量并自动缩放 ---
-	// 1. 计算底图的最大容量
-	subWidth := src.Bounds().Dx() / 2
-	subHeight := src.Bounds().Dy() / 2
-	maxCapacityBits := (subWidth / 8) * (subHeight / 8)
-	// 预留一些 header 空间 (比如 64 bits)
-	maxPixels := maxCapacityBits - 64
+	// 1. 计算底图的最大容量，扣除头部和纠错编码的开销后换算成像素数
+	maxCapacityBits := b.capacity(src)
+	maxPayload := maxCapacityBits / 8
+	for maxPayload > 0 && b.packedLen(maxPayload+b.payloadOverhead()) > maxCapacityBits {
+		maxPayload--
+	}
+	// payload 前 4 字节存宽高，连宽高加一个字节的像素都放不下时直接报错
+	if maxPayload < 4+1 {
+		need := b.packedLen(4 + 1 + b.payloadOverhead())
+		return nil, fmt.Errorf("image is too small to hold this watermark. Capacity: %d bits, Need: %d bits", maxCapacityBits, need)
+	}
+	maxPixels := (maxPayload - 4) * 8
 
 	// 2. 获取当前水印尺寸
 	w := wmImage.Bounds().Dx()
@@ -63,22 +149,28 @@ func (b *BlindWatermarker) EmbedImage(src image.Image, wmImage image.Image) (ima
 
 	// 3. 如果水印太大，进行缩放
 	if w*h > maxPixels {
-		fmt.Printf("⚠️ 水印过大 (%dx%d, %d pixels)，底图容量仅为 %d pixels。正在自动缩小...\n", w, h, w*h, maxPixels)
-
 		// 计算缩放比例
 		ratio := math.Sqrt(float64(maxPixels) / float64(w*h))
-		newW := int(float64(w) * ratio)
-		newH := int(float64(h) * ratio)
+		newW := max(int(float64(w)*ratio), 1)
+		newH := max(int(float64(h)*ratio), 1)
+		// 很扁或很高的图片按比例缩小后短边会变成 0，此时短边保留 1 像素，长边截到容量以内
+		if newW < newH {
+			newH = min(newH, maxPixels/newW)
+		} else {
+			newW = min(newW, maxPixels/newH)
+		}
 
 		// 缩放图片
 		dst := image.NewRGBA(image.Rect(0, 0, newW, newH))
 		draw.CatmullRom.Scale(dst, dst.Rect, wmImage, wmImage.Bounds(), draw.Over, nil)
 
+		b.logger().Info("watermark image resized to fit capacity",
+			"width", w, "height", h, "new_width", newW, "new_height", newH, "capacity_pixels", maxPixels)
+
 		// 更新 w, h 和 wmImage
 		wmImage = dst
 		w = newW
 		h = newH
-		fmt.Printf("✅ 水印已缩小为: %dx%d\n", w, h)
 	}
 
 	// 限制一下最大尺寸，防止溢出 uint16 (65535)
@@ -102,9 +194,10 @@ func (b *BlindWatermarker) EmbedImage(src image.Image, wmImage image.Image) (ima
 	// 注意：payload 的像素部分从第 4 个字节开始 (索引 4)
 	pixelData := payload[4:]
 
+	origin := wmImage.Bounds().Min
 	for y := 0; y < h; y++ {
 		for x := 0; x < w; x++ {
-			r, g, bb, _ := wmImage.At(x, y).RGBA()
+			r, g, bb, _ := wmImage.At(origin.X+x, origin.Y+y).RGBA()
 			lum := 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bb)
 
 			if lum/256 > 128 { // 判定为白色
@@ -117,10 +210,13 @@ func (b *BlindWatermarker) EmbedImage(src image.Image, wmImage image.Image) (ima
 		}
 	}
 
-	fmt.Printf("嵌入动态尺寸图片: %dx%d, 总数据量: %d bytes\n", w, h, len(payload))
+	b.logger().Debug("embedding image watermark", "width", w, "height", h, "payload_bytes", len(payload))
 
 	// 3. 打包并嵌入
-	bits := converter.Pack(converter.TypeImage, payload)
+	bits, err := b.pack(converter.TypeImage, payload)
+	if err != nil {
+		return nil, err
+	}
 	return b.embed(src, bits)
 }
 
@@ -128,49 +224,294 @@ func (b *BlindWatermarker) EmbedImage(src image.Image, wmImage image.Image) (ima
 func (b *BlindWatermarker) EmbedQRCode(src image.Image, content string) (image.Image, error) {
 	// 关键修改：我们不再生成 PNG 图片存进去，而是直接存字符串
 	// 但是我们要用 converter.TypeQRCode 标记它，这样提取时我们就知道把它还原成图片
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
 
 	// Pack: [Type:QRCode] [Len] [ContentString]
-	bits := converter.Pack(converter.TypeQRCode, []byte(content))
+	bits, err := b.pack(converter.TypeQRCode, []byte(content))
+	if err != nil {
+		return nil, err
+	}
 
 	return b.embed(src, bits)
 }
 
-// 内部嵌入逻辑，检查容量
-func (b *BlindWatermarker) embed(src image.Image, bits []bool) (image.Image, error) {
-	// DWT 版本容量计算修正：
-	// 我们只在 HL 频带嵌入，它是原图宽高的 1/2，所以面积是 1/4。
-	// 每个 8x8 的块存 1 bit。
+// pack 按配置压缩、加密、签名并打包载荷
+// 标志位先全部写进类型字节，加密和签名都对完整的类型字节做认证。配置由调用方 (各个 Embed 方法) 先行校验
+func (b *BlindWatermarker) pack(wmType converter.WatermarkType, data []byte) ([]bool, error) {
+	if b.Compress {
+		if compressed, ok := converter.Compress(data); ok {
+			wmType |= converter.FlagCompressed
+			data = compressed
+		}
+	}
+	if len(b.EncryptionKey) > 0 {
+		wmType |= converter.FlagEncrypted
+	}
+	if len(b.SigningKey) > 0 {
+		wmType |= converter.FlagSigned
+	}
 
-	// 计算 DWT 后子带的大小
-	subWidth := src.Bounds().Dx() / 2
-	subHeight := src.Bounds().Dy() / 2
+	if wmType.Encrypted() {
+		sealed, err := converter.Seal(b.EncryptionKey, wmType, data)
+		if err != nil {
+			return nil, err
+		}
+		data = sealed
+	}
+	if wmType.Signed() {
+		if len(b.SigningKey) != ed25519.PrivateKeySize {
+			return nil, fmt.Errorf("invalid ed25519 private key size: %d", len(b.SigningKey))
+		}
+		data = converter.Sign(b.SigningKey, wmType, data)
+	}
+	if b.CompactHeader {
+		return converter.PackCompact(wmType, data, b.FEC), nil
+	}
+	return converter.PackWithCodec(wmType, data, b.FEC), nil
+}
 
-	// 计算子带中有多少个 8x8 的块
-	capacity := (subWidth / 8) * (subHeight / 8)
+// packedLen n 字节载荷打包后的总 bit 数
+func (b *BlindWatermarker) packedLen(n int) int {
+	if b.CompactHeader {
+		return converter.CompactPackedLen(b.FEC, n)
+	}
+	return converter.PackedLen(b.FEC, n)
+}
 
-	fmt.Printf("当前图片水印容量: %d bits, 待写入数据: %d bits\n", capacity, len(bits)) // 方便调试
+// payloadOverhead 加密、签名等处理给载荷带来的额外字节数
+func (b *BlindWatermarker) payloadOverhead() int {
+	n := 0
+	if len(b.EncryptionKey) > 0 {
+		n += converter.SealOverhead
+	}
+	if len(b.SigningKey) > 0 {
+		n += converter.SignatureOverhead
+	}
+	return n
+}
+
+// capacity 底图 src 能嵌入的 bit 数，EmbedImage 和 embed 都按它检查
+// DWT 版本容量计算：
+// 默认只在 HL 频带嵌入，它是原图宽高的 1/2，所以面积是 1/4，每个 BlockSize x BlockSize (默认 8x8) 的块存 BitsPerBlock (默认 1) bit。
+// 每启用一个子带 (LH / HH) 容量增加一份；每多一级分解，子带面积再变为 1/4。
+// 启用色度通道 (Chroma) 时 Cb、Cr 各再增加与 Y 相同的一份，提取时三个通道按同样的顺序拼接。
+// 灰度底图的输出也是灰度，色度通道不计入容量。
+// 具体的计算在 core.Engine.ImageCapacity 中，这里不重复
+func (b *BlindWatermarker) capacity(src image.Image) int {
+	return b.engine.ImageCapacity(src)
+}
+
+// checkSize 检查底图的宽高是否放得下当前的分解级数和分块大小
+// 级数越深，最深一级的子带越小，宽或高小于 core.Engine.MinSize 时一个块也放不下
+func (b *BlindWatermarker) checkSize(src image.Image) error {
+	w, h, minSize := src.Bounds().Dx(), src.Bounds().Dy(), b.engine.MinSize()
+	if w < minSize || h < minSize {
+		return fmt.Errorf("image is too small for %d DWT levels: %dx%d, need at least %dx%d", max(b.engine.Levels, 1), w, h, minSize, minSize)
+	}
+	return nil
+}
+
+// 内部嵌入逻辑，检查容量；配置已由调用方校验过，尺寸和容量都按合法的配置计算
+func (b *BlindWatermarker) embed(src image.Image, bits []bool) (image.Image, error) {
+	if err := b.checkSize(src); err != nil {
+		return nil, err
+	}
+	capacity := b.capacity(src)
+
+	b.logger().Debug("embedding watermark", "capacity_bits", capacity, "payload_bits", len(bits))
 
 	if len(bits) > capacity {
 		return nil, fmt.Errorf("image is too small to hold this watermark. Capacity: %d bits, Need: %d bits", capacity, len(bits))
 	}
 
-	return b.engine.Embed(src, bits), nil
+	engine := b.engine
+	if b.TargetPSNR > 0 {
+		engine = b.calibrate(src, bits)
+	}
+	if b.Stream {
+		return engine.EmbedStream(src, bits), nil
+	}
+	return engine.Embed(src, bits), nil
+}
+
+// calibrate 返回调整过强度的引擎副本，使嵌入后的 PSNR 接近 TargetPSNR
+// 失真的能量大致与强度的平方成正比，按 PSNR 的差值换算强度，迭代几次即可收敛。
+// 同步模板的失真与强度无关，目标过高时强度停在下限
+func (b *BlindWatermarker) calibrate(src image.Image, bits []bool) *core.Engine {
+	engine := *b.engine
+	lo, hi := b.engine.Strength/4, b.engine.Strength*4
+	for range 4 {
+		var se float64
+		engine.EmbedBands(src, bits, func(band image.Image) error {
+			se += squaredError(src, band)
+			return nil
+		})
+		psnr := 10 * math.Log10(255*255*3*float64(src.Bounds().Dx()*src.Bounds().Dy())/math.Max(se, 1e-9))
+		b.logger().Debug("calibrating strength", "strength", engine.Strength, "psnr", psnr, "target_psnr", b.TargetPSNR)
+		if math.Abs(psnr-b.TargetPSNR) < 0.2 {
+			break
+		}
+		scale := math.Pow(10, (psnr-b.TargetPSNR)/20)
+		strength := min(max(engine.Strength*scale, lo), hi)
+		if strength == engine.Strength {
+			break
+		}
+		engine.ChromaStrength *= strength / engine.Strength
+		engine.Strength = strength
+	}
+	return &engine
+}
+
+// squaredError 嵌入结果 band (以 src 左上角为原点) 与 src 对应区域 R、G、B 的误差平方和，取值按 0-255 计
+func squaredError(src, band image.Image) float64 {
+	var se float64
+	r := band.Bounds()
+	origin := src.Bounds().Min
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			r1, g1, b1, _ := src.At(x+origin.X, y+origin.Y).RGBA()
+			r2, g2, b2, _ := band.At(x, y).RGBA()
+			for _, d := range [3]float64{float64(r1) - float64(r2), float64(g1) - float64(g2), float64(b1) - float64(b2)} {
+				se += d * d / (257 * 257)
+			}
+		}
+	}
+	return se
 }
 
 // watermark.go
 
 // 3. 提取并自动识别
 func (b *BlindWatermarker) Extract(watermarkedImg image.Image) (*Result, error) {
-	rawBits := b.engine.Extract(watermarkedImg)
+	return b.extract(watermarkedImg, (*core.Engine).ExtractSoft)
+}
+
+// ExtractResync 提取经过旋转 / 缩放 / 拉伸的图片中的水印
+// 先直接提取；分块模式下再按裁剪搜索分块网格；最后借助同步模板估计几何变换，重采样回原始网格后提取
+func (b *BlindWatermarker) ExtractResync(watermarkedImg image.Image) (*Result, error) {
+	if res, err := b.Extract(watermarkedImg); err == nil {
+		return res, nil
+	}
+	if b.engine.TileSize > 0 {
+		if res, err := b.extract(watermarkedImg, (*core.Engine).ExtractCroppedSoft); err == nil {
+			return res, nil
+		}
+	}
+	return b.extract(watermarkedImg, (*core.Engine).ExtractResyncSoft)
+}
 
-	wmType, data, err := converter.Unpack(rawBits)
+// extract 用 extractSoft 提取软判决值并还原水印内容
+func (b *BlindWatermarker) extract(img image.Image, extractSoft func(*core.Engine, image.Image) []float64) (*Result, error) {
+	soft, frame, err := b.extractFrame(img, extractSoft)
 	if err != nil {
 		return nil, err
 	}
+	res, err := b.decodePayload(soft, frame)
+	if err == nil {
+		b.logger().Debug("watermark extracted", "type", res.Type, "soft_bits", len(soft),
+			"confidence", res.Confidence, "bit_error_rate", res.BitErrorRate)
+	}
+	return res, err
+}
+
+// extractFrame 提取软判决值并解析出帧
+// 小波基不写入图片：开启 WaveletSearch 时，用配置的小波解不出水印就依次换用其他内置小波重试。
+// 相近的小波读出的同步字可能恰好匹配，因此校验失败 (ErrChecksumMismatch) 时同样重试
+func (b *BlindWatermarker) extractFrame(img image.Image, extractSoft func(*core.Engine, image.Image) []float64) ([]float64, *converter.Frame, error) {
+	if err := b.Validate(); err != nil {
+		return nil, nil, err
+	}
+	soft := extractSoft(b.engine, img)
+	frame, err := b.decodeFrame(soft)
+	if err == nil || !b.WaveletSearch {
+		return soft, frame, err
+	}
+
+	configured := core.Haar
+	if b.engine.Wavelet != nil {
+		configured = b.engine.Wavelet
+	}
+	for _, wl := range core.Wavelets {
+		if wl.Name() == configured.Name() {
+			continue
+		}
+		engine := *b.engine
+		engine.Wavelet = wl
+		altSoft := extractSoft(&engine, img)
+		if altFrame, altErr := b.decodeFrame(altSoft); altErr == nil {
+			b.logger().Debug("watermark found with another wavelet", "configured", configured.Name(), "wavelet", wl.Name())
+			return altSoft, altFrame, nil
+		}
+	}
+	return nil, nil, err
+}
+
+// VerifyExtract 提取水印并用公钥校验签名，返回提取结果和签名是否有效
+// 水印未签名或签名与公钥不符时 valid 为 false，但只要能解析出内容 res 依然有效
+// 签名覆盖的是加密后的密文，没有解密密钥也能校验：此时返回 valid 和 converter.ErrKeyRequired
+func (b *BlindWatermarker) VerifyExtract(watermarkedImg image.Image, publicKey ed25519.PublicKey) (res *Result, valid bool, err error) {
+	soft, frame, err := b.extractFrame(watermarkedImg, (*core.Engine).ExtractSoft)
+	if err != nil {
+		return nil, false, err
+	}
+	if frame.Type.Signed() {
+		if data, sig, err := converter.SplitSignature(frame.Data); err == nil {
+			valid = converter.Verify(publicKey, frame.Type, data, sig)
+		}
+	}
+	res, err = b.decodePayload(soft, frame)
+	return res, valid, err
+}
+
+// decodeFrame 从软判决值中解析出帧
+func (b *BlindWatermarker) decodeFrame(soft []float64) (*converter.Frame, error) {
+	if b.engine.Redundant {
+		// 冗余嵌入：对所有副本加权表决后再解析
+		return converter.DecodeRepeatedFrame(soft)
+	}
+	return converter.DecodeFrame(soft)
+}
+
+// decodePayload 去掉签名、解密，并按类型还原水印内容
+func (b *BlindWatermarker) decodePayload(soft []float64, frame *converter.Frame) (*Result, error) {
+	wmType, data := frame.Type, frame.Data
+	var err error
+
+	// 签名位于最外层，先剥离，签名的校验留给 VerifyExtract
+	var sig []byte
+	if wmType.Signed() {
+		data, sig, err = converter.SplitSignature(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 加密载荷：先认证解密，失败时返回明确的错误而不是乱码
+	if wmType.Encrypted() {
+		if len(b.EncryptionKey) == 0 {
+			return nil, converter.ErrKeyRequired
+		}
+		data, err = converter.Open(b.EncryptionKey, wmType, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if wmType.Compressed() {
+		if data, err = converter.Decompress(data); err != nil {
+			return nil, err
+		}
+	}
+	wmType = wmType.Base()
 
 	res := &Result{
-		Type: wmType,
+		Type:      wmType,
+		Encrypted: frame.Type.Encrypted(),
+		Signed:    frame.Type.Signed(),
+		Signature: sig,
 	}
+	res.Confidence, res.BitErrorRate = b.quality(soft, frame.Bits)
 
 	switch wmType {
 	case converter.TypeText:
@@ -180,7 +521,7 @@ func (b *BlindWatermarker) Extract(watermarkedImg image.Image) (*Result, error)
 		// 至少要有 4 个字节存宽高
 		if len(data) < 4 {
 			res.ImageBytes = data
-			fmt.Println("Error: Data too short to contain dimensions")
+			b.logger().Warn("image watermark too short to contain dimensions", "bytes", len(data))
 			break
 		}
 
@@ -188,7 +529,7 @@ func (b *BlindWatermarker) Extract(watermarkedImg image.Image) (*Result, error)
 		w := int(binary.BigEndian.Uint16(data[0:2]))
 		h := int(binary.BigEndian.Uint16(data[2:4]))
 
-		fmt.Printf("提取到图片尺寸信息: %dx%d\n", w, h)
+		b.logger().Debug("extracted image watermark", "width", w, "height", h)
 
 		// 2. 校验数据长度是否匹配
 		expectedPixelLen := (w*h + 7) / 8
@@ -197,7 +538,8 @@ func (b *BlindWatermarker) Extract(watermarkedImg image.Image) (*Result, error)
 		if actualPixelLen != expectedPixelLen {
 			// 允许最后多一点点 padding bit，但不能少
 			if actualPixelLen < expectedPixelLen {
-				fmt.Printf("Warning: Data incomplete. Expected %d pixels, got %d bytes\n", expectedPixelLen, actualPixelLen)
+				b.logger().Warn("image watermark data incomplete", "width", w, "height", h,
+					"expected_bytes", expectedPixelLen, "actual_bytes", actualPixelLen)
 			}
 		}
 
@@ -227,7 +569,9 @@ func (b *BlindWatermarker) Extract(watermarkedImg image.Image) (*Result, error)
 		}
 
 		var buf bytes.Buffer
-		png.Encode(&buf, img)
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, fmt.Errorf("encode watermark image: %w", err)
+		}
 		res.ImageBytes = buf.Bytes()
 	case converter.TypeQRCode:
 		// 关键修改：提取到的是文本数据
@@ -239,7 +583,7 @@ func (b *BlindWatermarker) Extract(watermarkedImg image.Image) (*Result, error)
 		qrPng, err := qrcode.Encode(content, qrcode.Medium, 256)
 		if err != nil {
 			// 如果生成失败，至少返回文本
-			fmt.Printf("Warning: Failed to regenerate QR image: %v\n", err)
+			b.logger().Warn("failed to regenerate QR code image", "error", err)
 		} else {
 			res.ImageBytes = qrPng
 		}
@@ -248,6 +592,53 @@ func (b *BlindWatermarker) Extract(watermarkedImg image.Image) (*Result, error)
 	return res, nil
 }
 
+// quality 对照重新编码的整帧 ref，估计整体置信度和信道误码率
+func (b *BlindWatermarker) quality(soft []float64, ref []bool) (confidence, ber float64) {
+	// 冗余模式下整个 soft 都是 ref 的循环副本，否则只有开头的一份
+	n := len(soft)
+	if !b.engine.Redundant {
+		n = min(len(ref), len(soft))
+	}
+	if n == 0 || len(ref) == 0 {
+		return 0, 0
+	}
+
+	// 1. 把软判决值按正确的符号翻正，统计误码并拟合高斯模型 N(mu, sigma^2)
+	errors := 0
+	sum, sumSq := 0.0, 0.0
+	for i := 0; i < n; i++ {
+		x := soft[i]
+		if !ref[i%len(ref)] {
+			x = -x
+		}
+		if x < 0 || (x == 0 && !ref[i%len(ref)]) {
+			errors++
+		}
+		sum += x
+		sumSq += x * x
+	}
+	ber = float64(errors) / float64(n)
+	mu := sum / float64(n)
+	variance := math.Max(sumSq/float64(n)-mu*mu, 1e-6)
+	if mu <= 0 {
+		return 0, ber
+	}
+
+	// 2. 每一位的 LLR = 2*mu*x/sigma^2，冗余模式下各副本的 LLR 相加
+	llr := make([]float64, min(len(ref), n))
+	for i := 0; i < n; i++ {
+		llr[i%len(ref)] += 2 * mu * soft[i] / variance
+	}
+
+	// 3. 判决正确的后验概率取平均，再线性映射到 [0, 1]
+	total := 0.0
+	for _, l := range llr {
+		total += 1 / (1 + math.Exp(-math.Abs(l)))
+	}
+	confidence = 2*total/float64(len(llr)) - 1
+	return confidence, ber
+}
+
 // 将生成的图片字节保存为图片
 func (b *BlindWatermarker) SaveImgFile(name string, img image.Image) {
 	f, _ := os.Create(name)
@@ -0,0 +1,367 @@
+package blindwatermark
+
+import (
+	"blindwatermark/converter"
+	"blindwatermark/core"
+	"blindwatermark/internal/testimage"
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestExtractResyncRecipe README 中推荐的抗几何变换设置能从缩放和旋转后的图片中解出原文
+func TestExtractResyncRecipe(t *testing.T) {
+	if testing.Short() {
+		t.Skip("resampling a 1014x1014 image fourteen times")
+	}
+	bw := NewBlindWatermarker(
+		WithSyncStrength(1),
+		WithLevels(2),
+		WithFEC(converter.NewConvolutional()),
+		WithRedundant(true),
+	)
+	marked, err := bw.EmbedText(testimage.Photo(t, 1014, 1014), "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct{ angle, scale float64 }{
+		{0, 0.8}, {0, 1.25}, {3, 1}, {-5, 1}, {10, 1}, {5, 0.8}, {-7, 1.25},
+		// README 给出的范围两端
+		{0, 2}, {20, 1}, {-20, 1}, {20, 0.8}, {-20, 0.8}, {20, 2}, {-15, 2},
+	} {
+		res, err := bw.ExtractResync(testimage.RotateScale(marked, c.angle, c.scale))
+		if err != nil {
+			t.Errorf("rotate %v scale %v: %v", c.angle, c.scale, err)
+			continue
+		}
+		if res.TextContent != "hello" {
+			t.Errorf("rotate %v scale %v: got %q", c.angle, c.scale, res.TextContent)
+		}
+	}
+}
+
+// TestFECJPEG90 README 中给出的纠错设置在默认参数下能承受 JPEG q90 压缩
+func TestFECJPEG90(t *testing.T) {
+	short, long := "hello, blind watermark", strings.Repeat("user-1234567890;", 6)
+	rs4, _ := converter.NewReedSolomon(4)
+	rs8, _ := converter.NewReedSolomon(8)
+	src := testimage.Photo(t, 1531, 1014)
+	for _, c := range []struct {
+		name string
+		fec  converter.Codec
+		text string
+	}{
+		{"convolutional", converter.NewConvolutional(), short},
+		{"convolutional", converter.NewConvolutional(), long},
+		{"reed-solomon 4", rs4, short},
+		{"reed-solomon 8", rs8, long},
+	} {
+		bw := NewBlindWatermarker(WithFEC(c.fec))
+		marked, err := bw.EmbedText(src, c.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := bw.Extract(testimage.JPEGRoundTrip(t, marked, 90))
+		if err != nil {
+			t.Errorf("%s, %d bytes: %v", c.name, len(c.text), err)
+			continue
+		}
+		if res.TextContent != c.text {
+			t.Errorf("%s, %d bytes: got %q", c.name, len(c.text), res.TextContent)
+		}
+	}
+}
+
+// TestExtractConfidence 未受攻击时置信度接近 1、误码率为 0；JPEG 压缩后两者都反映出信道变差
+func TestExtractConfidence(t *testing.T) {
+	bw := NewBlindWatermarker(WithFEC(converter.NewConvolutional()), WithRedundant(true))
+	marked, err := bw.EmbedText(testimage.Photo(t, 512, 512), "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clean, err := bw.Extract(marked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clean.Confidence < 0.99 || clean.BitErrorRate != 0 {
+		t.Errorf("clean image: confidence %.3f, BER %.4f", clean.Confidence, clean.BitErrorRate)
+	}
+
+	compressed, err := bw.Extract(testimage.JPEGRoundTrip(t, marked, 85))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("q85: confidence %.3f, BER %.4f", compressed.Confidence, compressed.BitErrorRate)
+	if compressed.TextContent != "hello" {
+		t.Errorf("q85: got %q", compressed.TextContent)
+	}
+	if compressed.BitErrorRate == 0 || compressed.Confidence >= clean.Confidence || compressed.Confidence <= 0 {
+		t.Errorf("q85: confidence %.3f, BER %.4f", compressed.Confidence, compressed.BitErrorRate)
+	}
+}
+
+// TestExtractEncrypted 加密水印需要同一把密钥；没有密钥或密钥错误时返回明确的错误
+func TestExtractEncrypted(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	marked, err := NewBlindWatermarker(WithEncryptionKey(key)).EmbedText(testimage.Photo(t, 512, 512), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := NewBlindWatermarker(WithEncryptionKey(key)).Extract(marked)
+	if err != nil || res.TextContent != "secret" || !res.Encrypted {
+		t.Fatalf("right key: %+v, %v", res, err)
+	}
+	if _, err := NewBlindWatermarker().Extract(marked); !errors.Is(err, converter.ErrKeyRequired) {
+		t.Errorf("no key: got %v, want ErrKeyRequired", err)
+	}
+	if _, err := NewBlindWatermarker(WithEncryptionKey([]byte("fedcba9876543210"))).Extract(marked); !errors.Is(err, converter.ErrAuthFailed) {
+		t.Errorf("wrong key: got %v, want ErrAuthFailed", err)
+	}
+}
+
+// TestVerifyExtract 签名水印用对应的公钥校验通过，换一把公钥时内容照常返回但 valid 为 false；
+// 同时加密时没有解密密钥也能校验签名
+func TestVerifyExtract(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	otherPub, _, _ := ed25519.GenerateKey(nil)
+	src := testimage.Photo(t, 512, 512)
+
+	bw := NewBlindWatermarker(WithSigningKey(priv))
+	marked, err := bw.EmbedText(src, "signed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, valid, err := bw.VerifyExtract(marked, pub)
+	if err != nil || !valid || res.TextContent != "signed" || !res.Signed {
+		t.Fatalf("right key: %+v, %v, %v", res, valid, err)
+	}
+	if res, valid, err := bw.VerifyExtract(marked, otherPub); err != nil || valid || res.TextContent != "signed" {
+		t.Errorf("other key: %+v, %v, %v", res, valid, err)
+	}
+
+	key := []byte("0123456789abcdef")
+	marked, err = NewBlindWatermarker(WithSigningKey(priv), WithEncryptionKey(key)).EmbedText(src, "signed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, valid, err := NewBlindWatermarker().VerifyExtract(marked, pub); !valid || !errors.Is(err, converter.ErrKeyRequired) {
+		t.Errorf("encrypted, no key: valid %v, %v", valid, err)
+	}
+}
+
+// TestCompactCompress 紧凑头部和压缩减少占用的容量，提取时自动还原
+func TestCompactCompress(t *testing.T) {
+	text := strings.Repeat("https://example.com/user/42 ", 4)
+	plain := NewBlindWatermarker()
+	small := NewBlindWatermarker(WithCompactHeader(true), WithCompress(true))
+	if small.packedLen(len(text)) >= plain.packedLen(len(text)) {
+		t.Errorf("compact header: %d bits, standard %d", small.packedLen(len(text)), plain.packedLen(len(text)))
+	}
+	bits, err := small.pack(converter.TypeText, []byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bits) >= plain.packedLen(len(text)) {
+		t.Errorf("compressed frame is %d bits, uncompressed %d", len(bits), plain.packedLen(len(text)))
+	}
+
+	marked, err := small.EmbedText(testimage.Photo(t, 512, 512), text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := NewBlindWatermarker().Extract(marked)
+	if err != nil || res.TextContent != text {
+		t.Fatalf("got %+v, %v", res, err)
+	}
+}
+
+// TestWaveletSearch 默认只用配置的小波提取；开启 WaveletSearch 后能找出嵌入端使用的小波
+func TestWaveletSearch(t *testing.T) {
+	marked, err := NewBlindWatermarker(WithWavelet(core.CDF97)).EmbedText(testimage.Photo(t, 512, 512), "cdf97")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewBlindWatermarker().Extract(marked); err == nil {
+		t.Error("haar without search: extracted a cdf97 watermark")
+	}
+	res, err := NewBlindWatermarker(WithWaveletSearch(true)).Extract(marked)
+	if err != nil || res.TextContent != "cdf97" {
+		t.Errorf("haar with search: got %+v, %v", res, err)
+	}
+}
+
+// TestExtractUnmarked 没有水印的图片很快返回 ErrNoWatermark
+func TestExtractUnmarked(t *testing.T) {
+	start := time.Now()
+	if _, err := NewBlindWatermarker().Extract(testimage.Photo(t, 1531, 1014)); !errors.Is(err, converter.ErrNoWatermark) {
+		t.Errorf("got %v, want ErrNoWatermark", err)
+	}
+	t.Logf("took %v", time.Since(start))
+}
+
+// TestEmbedImageSubImage 水印图片是左上角不在 (0, 0) 的 SubImage 时按自身边界读取
+func TestEmbedImageSubImage(t *testing.T) {
+	logo := image.NewGray(image.Rect(0, 0, 64, 64))
+	for y := range 64 {
+		for x := range 64 {
+			if (x/4+y/4)%2 == 0 {
+				logo.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	sub := logo.SubImage(image.Rect(20, 30, 44, 46)) // 24x16，左上角 (20, 30) 是白色
+	marked, err := NewBlindWatermarker().EmbedImage(testimage.Photo(t, 1014, 1014), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := NewBlindWatermarker().Extract(marked)
+	if err != nil || res.Type != converter.TypeImage {
+		t.Fatalf("got %+v, %v", res, err)
+	}
+	got, err := png.Decode(bytes.NewReader(res.ImageBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Bounds() != image.Rect(0, 0, 24, 16) {
+		t.Fatalf("extracted image bounds %v, want 24x16", got.Bounds())
+	}
+	for y := range 16 {
+		for x := range 24 {
+			r, _, _, _ := got.At(x, y).RGBA()
+			if want := logo.GrayAt(20+x, 30+y).Y == 255; (r > 0x8000) != want {
+				t.Fatalf("pixel (%d, %d) differs from the SubImage", x, y)
+			}
+		}
+	}
+}
+
+// TestTargetPSNR 调整强度使输出的 PSNR 接近目标值，提取端不需要知道调整后的强度
+func TestTargetPSNR(t *testing.T) {
+	src := testimage.Photo(t, 512, 512)
+	measure := func(bw *BlindWatermarker) float64 {
+		t.Helper()
+		marked, err := bw.EmbedText(src, "psnr")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res, err := bw.Extract(marked); err != nil || res.TextContent != "psnr" {
+			t.Errorf("target %v: got %+v, %v", bw.TargetPSNR, res, err)
+		}
+		return 10 * math.Log10(255*255*3*512*512/squaredError(src, marked))
+	}
+	for _, target := range []float64{42, 50} {
+		for _, adaptive := range []bool{false, true} {
+			bw := NewBlindWatermarkerWithEngine(&core.Engine{Strength: 20, Refine: 2, Redundant: true, Adaptive: adaptive})
+			bw.TargetPSNR = target
+			if got := measure(bw); math.Abs(got-target) > 0.5 {
+				t.Errorf("target %v, adaptive=%v: PSNR %.2f dB", target, adaptive, got)
+			}
+		}
+	}
+
+	// 只有几十位的载荷在强度上限 (4 倍) 时也达不到 40 dB，强度停在上限
+	bw := NewBlindWatermarkerWithEngine(&core.Engine{Strength: 20, Refine: 2})
+	bw.TargetPSNR = 40
+	capped := measure(bw)
+	bw = NewBlindWatermarkerWithEngine(&core.Engine{Strength: 80, Refine: 2})
+	if full := measure(bw); capped != full {
+		t.Errorf("unreachable target: PSNR %.2f dB, want %.2f dB at 4x strength", capped, full)
+	}
+}
+
+// TestEmbedImageTooSmall 底图连宽高都放不下时返回错误，不会在缩放时崩溃
+func TestEmbedImageTooSmall(t *testing.T) {
+	logo := image.NewGray(image.Rect(0, 0, 64, 64))
+	if _, err := NewBlindWatermarker().EmbedImage(testimage.Photo(t, 40, 40), logo); err == nil || !strings.Contains(err.Error(), "too small") {
+		t.Errorf("got %v, want an image too small error", err)
+	}
+}
+
+// TestEmbedImageResize 放不下的水印图片按原比例缩小到容量以内
+func TestEmbedImageResize(t *testing.T) {
+	logo := image.NewGray(image.Rect(0, 0, 300, 150))
+	bw := NewBlindWatermarker()
+	marked, err := bw.EmbedImage(testimage.Photo(t, 512, 512), logo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := bw.Extract(marked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := png.Decode(bytes.NewReader(res.ImageBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, h := got.Bounds().Dx(), got.Bounds().Dy()
+	if w >= 300 || w < 2*h-2 || w > 2*h+2 {
+		t.Errorf("resized to %dx%d, want a smaller 2:1 image", w, h)
+	}
+}
+
+// TestEmbedGrayChroma 灰度底图没有色度可用：容量只按 Y 计算，放不下的文本报错，而不是嵌入后提取失败
+func TestEmbedGrayChroma(t *testing.T) {
+	photo := testimage.Photo(t, 512, 512)
+	gray := image.NewGray(photo.Rect)
+	for y := range 512 {
+		for x := range 512 {
+			gray.Set(x, y, photo.At(x, y))
+		}
+	}
+	bw := NewBlindWatermarker(WithChroma(core.ChannelCb|core.ChannelCr, 0))
+	if _, err := bw.EmbedText(gray, strings.Repeat("x", 270)); err == nil || !strings.Contains(err.Error(), "too small") {
+		t.Errorf("270 bytes in a gray image: got %v, want a capacity error", err)
+	}
+	marked, err := bw.EmbedText(gray, "gray")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := bw.Extract(marked); err != nil || res.TextContent != "gray" {
+		t.Errorf("got %v, %v", res, err)
+	}
+}
+
+// TestEmbedImageThin 很扁的水印图片缩小后短边至少保留 1 像素，提取出的图片能正常解码
+func TestEmbedImageThin(t *testing.T) {
+	bw := NewBlindWatermarker()
+	for _, size := range []image.Point{{5000, 2}, {2, 5000}} {
+		marked, err := bw.EmbedImage(testimage.Photo(t, 256, 256), image.NewGray(image.Rectangle{Max: size}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := bw.Extract(marked)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := png.Decode(bytes.NewReader(res.ImageBytes))
+		if err != nil {
+			t.Fatalf("%v: %v", size, err)
+		}
+		if b := got.Bounds(); b.Empty() || b.Dx() > size.X || b.Dy() > size.Y {
+			t.Errorf("%v: resized to %v", size, b.Size())
+		}
+	}
+}
+
+// TestExtractEmptyImage 宽或高为 0 的图片水印无法编码为 PNG，返回错误而不是空的 ImageBytes
+func TestExtractEmptyImage(t *testing.T) {
+	bw := NewBlindWatermarker()
+	bits, err := bw.pack(converter.TypeImage, []byte{0x13, 0x88, 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	marked, err := bw.embed(testimage.Photo(t, 256, 256), bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := bw.Extract(marked); err == nil {
+		t.Errorf("got %d image bytes, want an encoding error", len(res.ImageBytes))
+	}
+}
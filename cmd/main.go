@@ -7,6 +7,7 @@ import (
 	"image"
 	_ "image/jpeg"
 	_ "image/png"
+	"log/slog"
 	"os"
 )
 
@@ -16,7 +17,9 @@ func main() {
 	defer file.Close()
 	srcImg, _, _ := image.Decode(file)
 
-	bw := blindwatermark.NewBlindWatermarker()
+	// 诊断信息 (容量、载荷大小、水印缩放等) 输出到 stderr
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	bw := blindwatermark.NewBlindWatermarker(blindwatermark.WithLogger(logger))
 
 	// 2. 嵌入字符串
 	fmt.Println("正在嵌入字符串水印...")
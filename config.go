@@ -0,0 +1,319 @@
+package blindwatermark
+
+import (
+	"blindwatermark/converter"
+	"blindwatermark/core"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// ErrInvalidConfig 配置无效，Validate 返回的各项错误都包装了它
+var ErrInvalidConfig = errors.New("invalid config")
+
+// Config BlindWatermarker 的可序列化配置 (JSON / YAML)，字段与 core.Engine 和 BlindWatermarker 的设置一一对应。
+// 枚举按名称保存：子带为 "HL" / "LH" / "HH"，小波为 core.Wavelet 的 Name()，调制方式为 "pair" / "qim" / "stdm"，
+// 色度通道为 "cb" / "cr"，纠错编码为 "reed-solomon" / "convolutional"，空值表示默认。
+// 加密和签名密钥不属于配置，用 WithEncryptionKey / WithSigningKey 设置，避免随配置文件一起保存 (Logger 同样用 WithLogger 设置)；
+// Key 决定嵌入位置，提取时必须一致，因此保留在配置中 (JSON 中为 base64)，同样需要妥善保管。
+// 从文件读取时应先取 DefaultConfig() 再反序列化，文件中没有的字段保持默认值
+type Config struct {
+	Strength       float64     `json:"strength" yaml:"strength"`
+	SyncStrength   float64     `json:"sync_strength" yaml:"sync_strength"`
+	Subbands       []string    `json:"subbands,omitempty" yaml:"subbands,omitempty"`
+	Levels         int         `json:"levels" yaml:"levels"`
+	Wavelet        string      `json:"wavelet,omitempty" yaml:"wavelet,omitempty"`
+	BlockSize      int         `json:"block_size" yaml:"block_size"`
+	Pairs          [][2][2]int `json:"pairs,omitempty" yaml:"pairs,omitempty"`
+	BitsPerBlock   int         `json:"bits_per_block" yaml:"bits_per_block"`
+	Modulation     string      `json:"modulation,omitempty" yaml:"modulation,omitempty"`
+	Step           float64     `json:"step" yaml:"step"`
+	Adaptive       bool        `json:"adaptive" yaml:"adaptive"`
+	Chroma         []string    `json:"chroma,omitempty" yaml:"chroma,omitempty"`
+	ChromaStrength float64     `json:"chroma_strength" yaml:"chroma_strength"`
+	Redundant      bool        `json:"redundant" yaml:"redundant"`
+	Refine         int         `json:"refine" yaml:"refine"`
+	TileSize       int         `json:"tile_size" yaml:"tile_size"`
+	Workers        int         `json:"workers" yaml:"workers"`
+	Key            []byte      `json:"key,omitempty" yaml:"key,omitempty"`
+
+	FEC           string  `json:"fec,omitempty" yaml:"fec,omitempty"`
+	FECLevel      int     `json:"fec_level" yaml:"fec_level"`
+	CompactHeader bool    `json:"compact_header" yaml:"compact_header"`
+	Compress      bool    `json:"compress" yaml:"compress"`
+	Stream        bool    `json:"stream" yaml:"stream"`
+	TargetPSNR    float64 `json:"target_psnr" yaml:"target_psnr"`
+	WaveletSearch bool    `json:"wavelet_search" yaml:"wavelet_search"`
+}
+
+// 枚举的名称
+var (
+	subbandNames    = map[core.Subband]string{core.SubbandHL: "HL", core.SubbandLH: "LH", core.SubbandHH: "HH"}
+	channelNames    = map[core.Channel]string{core.ChannelCb: "cb", core.ChannelCr: "cr"}
+	modulationNames = map[core.Modulation]string{core.ModulationPair: "pair", core.ModulationQIM: "qim", core.ModulationSTDM: "stdm"}
+	codecNames      = map[converter.CodecID]string{converter.CodecReedSolomon: "reed-solomon", converter.CodecConvolutional: "convolutional"}
+)
+
+// DefaultConfig NewBlindWatermarker() 的默认配置
+func DefaultConfig() Config {
+	return NewBlindWatermarker().Config()
+}
+
+// NewBlindWatermarkerFromConfig 按配置创建 BlindWatermarker，配置无效时返回错误
+// opts 在配置之后应用，用于设置密钥、自定义的纠错编码等不能序列化的项
+func NewBlindWatermarkerFromConfig(cfg Config, opts ...Option) (*BlindWatermarker, error) {
+	b, err := cfg.build()
+	if err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Validate 检查配置，返回所有问题 (errors.Join)
+func (c Config) Validate() error {
+	_, err := c.build()
+	return err
+}
+
+// build 把配置转换为 BlindWatermarker，名称无法识别或组合不合理时返回错误
+func (c Config) build() (*BlindWatermarker, error) {
+	var errs []error
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%w: "+format, append([]any{ErrInvalidConfig}, args...)...))
+	}
+
+	e := &core.Engine{
+		Strength:       c.Strength,
+		SyncStrength:   c.SyncStrength,
+		Levels:         c.Levels,
+		BlockSize:      c.BlockSize,
+		Pairs:          c.Pairs,
+		BitsPerBlock:   c.BitsPerBlock,
+		Step:           c.Step,
+		Adaptive:       c.Adaptive,
+		ChromaStrength: c.ChromaStrength,
+		Redundant:      c.Redundant,
+		Refine:         c.Refine,
+		TileSize:       c.TileSize,
+		Workers:        c.Workers,
+		Key:            c.Key,
+	}
+	for _, name := range c.Subbands {
+		if sb, ok := lookupName(subbandNames, name); ok {
+			e.Subbands |= sb
+		} else {
+			invalid("unknown subband %q", name)
+		}
+	}
+	for _, name := range c.Chroma {
+		if ch, ok := lookupName(channelNames, name); ok {
+			e.Chroma |= ch
+		} else {
+			invalid("unknown chroma channel %q", name)
+		}
+	}
+	if c.Wavelet != "" {
+		if e.Wavelet = core.WaveletByName(c.Wavelet); e.Wavelet == nil {
+			invalid("unknown wavelet %q", c.Wavelet)
+		}
+	}
+	if c.Modulation != "" {
+		if m, ok := lookupName(modulationNames, c.Modulation); ok {
+			e.Modulation = m
+		} else {
+			invalid("unknown modulation %q", c.Modulation)
+		}
+	}
+
+	b := &BlindWatermarker{
+		engine:        e,
+		CompactHeader: c.CompactHeader,
+		Compress:      c.Compress,
+		Stream:        c.Stream,
+		TargetPSNR:    c.TargetPSNR,
+		WaveletSearch: c.WaveletSearch,
+	}
+	if c.FEC != "" {
+		if id, ok := lookupName(codecNames, c.FEC); !ok {
+			invalid("unknown fec %q", c.FEC)
+		} else if codec, err := converter.NewCodec(id, c.FECLevel); err != nil {
+			invalid("fec: %v", err)
+		} else {
+			b.FEC = codec
+		}
+	}
+
+	if err := b.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// lookupName 按名称反查枚举值
+func lookupName[T comparable](names map[T]string, name string) (T, bool) {
+	for v, n := range names {
+		if n == name {
+			return v, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// Config 当前设置对应的配置，不含加密和签名密钥
+func (b *BlindWatermarker) Config() Config {
+	e := b.engine
+	c := Config{
+		Strength:       e.Strength,
+		SyncStrength:   e.SyncStrength,
+		Levels:         e.Levels,
+		BlockSize:      e.BlockSize,
+		Pairs:          e.Pairs,
+		BitsPerBlock:   e.BitsPerBlock,
+		Modulation:     modulationNames[e.Modulation],
+		Step:           e.Step,
+		Adaptive:       e.Adaptive,
+		ChromaStrength: e.ChromaStrength,
+		Redundant:      e.Redundant,
+		Refine:         e.Refine,
+		TileSize:       e.TileSize,
+		Workers:        e.Workers,
+		Key:            e.Key,
+		CompactHeader:  b.CompactHeader,
+		Compress:       b.Compress,
+		Stream:         b.Stream,
+		TargetPSNR:     b.TargetPSNR,
+		WaveletSearch:  b.WaveletSearch,
+	}
+	for _, sb := range []core.Subband{core.SubbandHL, core.SubbandLH, core.SubbandHH} {
+		if e.Subbands&sb != 0 {
+			c.Subbands = append(c.Subbands, subbandNames[sb])
+		}
+	}
+	for _, ch := range []core.Channel{core.ChannelCb, core.ChannelCr} {
+		if e.Chroma&ch != 0 {
+			c.Chroma = append(c.Chroma, channelNames[ch])
+		}
+	}
+	if e.Wavelet != nil {
+		c.Wavelet = e.Wavelet.Name()
+	}
+	if b.FEC != nil {
+		c.FEC = codecNames[b.FEC.ID()]
+		c.FECLevel = b.FEC.Level()
+	}
+	return c
+}
+
+// Validate 检查当前设置，返回所有不合理的组合 (errors.Join)，没有问题时返回 nil
+// 嵌入和提取前都会调用，避免无效的设置在变换中途 panic 或写出无法提取的图片
+func (b *BlindWatermarker) Validate() error {
+	var errs []error
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%w: "+format, append([]any{ErrInvalidConfig}, args...)...))
+	}
+	e := b.engine
+
+	// 数值范围
+	for _, f := range []struct {
+		name  string
+		value float64
+	}{
+		{"strength", e.Strength}, {"sync_strength", e.SyncStrength}, {"step", e.Step},
+		{"chroma_strength", e.ChromaStrength}, {"target_psnr", b.TargetPSNR},
+		{"levels", float64(e.Levels)}, {"bits_per_block", float64(e.BitsPerBlock)}, {"refine", float64(e.Refine)},
+		{"tile_size", float64(e.TileSize)}, {"workers", float64(e.Workers)},
+	} {
+		if math.IsNaN(f.value) || math.IsInf(f.value, 0) {
+			invalid("%s must be a finite number, got %v", f.name, f.value)
+		} else if f.value < 0 {
+			invalid("%s must not be negative, got %v", f.name, f.value)
+		}
+	}
+	if e.Levels > core.MaxLevels {
+		invalid("levels must be at most %d, got %d", core.MaxLevels, e.Levels)
+	}
+	if e.Subbands&^(core.SubbandHL|core.SubbandLH|core.SubbandHH) != 0 {
+		invalid("unknown subbands %#x", int(e.Subbands))
+	}
+	if e.Chroma&^(core.ChannelCb|core.ChannelCr) != 0 {
+		invalid("unknown chroma channels %#x", int(e.Chroma))
+	}
+	if _, ok := modulationNames[e.Modulation]; !ok {
+		invalid("unknown modulation %d", e.Modulation)
+	}
+	n := e.BlockSize
+	switch n {
+	case 0:
+		n = core.N
+	case 4, 8, 16:
+	default:
+		invalid("block_size must be 4, 8 or 16, got %d", e.BlockSize)
+		n = core.MaxBlockSize // 分块边长本身无效时不再按它检查系数下标
+	}
+
+	// 调制方式相关的组合
+	if e.Modulation == core.ModulationPair {
+		if e.Strength == 0 {
+			invalid("strength must be positive")
+		}
+		if e.Step > 0 {
+			invalid("step only applies to qim / stdm modulation")
+		}
+	} else if b.TargetPSNR > 0 {
+		invalid("target_psnr only applies to pair modulation, choose step for qim / stdm instead")
+	}
+	if e.ChromaStrength > 0 && e.Chroma == 0 {
+		invalid("chroma_strength is set but no chroma channel is enabled")
+	}
+
+	// 系数对：下标在块内，两个系数不同，多位时各对不共用系数
+	var used [][2]int
+	for _, p := range e.Pairs {
+		for _, c := range p {
+			if c[0] < 0 || c[0] >= n || c[1] < 0 || c[1] >= n {
+				invalid("pair %v is outside the %dx%d block", p, n, n)
+			}
+		}
+		if p[0] == p[1] {
+			invalid("pair %v compares a coefficient with itself", p)
+		}
+		if e.BitsPerBlock > 1 && (slices.Contains(used, p[0]) || slices.Contains(used, p[1])) {
+			invalid("pair %v shares a coefficient with another pair, which is not allowed with bits_per_block > 1", p)
+		}
+		used = append(used, p[0], p[1])
+	}
+	pairs := len(e.Pairs)
+	if pairs == 0 {
+		pairs = len(core.DefaultPairs(n))
+	}
+	if e.BitsPerBlock > pairs {
+		invalid("bits_per_block %d exceeds the number of pairs (%d)", e.BitsPerBlock, pairs)
+	}
+	if e.BitsPerBlock > 1 && e.Modulation == core.ModulationSTDM {
+		invalid("stdm modulation stores one bit per block")
+	}
+	if e.TileSize > 0 && e.Modulation == core.ModulationPair && pairs < 2 {
+		invalid("tile mode needs at least two pairs to locate the tile grid")
+	}
+
+	// 密钥
+	if k := len(b.EncryptionKey); k != 0 && k != 16 && k != 24 && k != 32 {
+		invalid("encryption key must be 16, 24 or 32 bytes, got %d", k)
+	}
+	if k := len(b.SigningKey); k != 0 && k != ed25519.PrivateKeySize {
+		invalid("signing key must be %d bytes, got %d", ed25519.PrivateKeySize, k)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,186 @@
+package blindwatermark
+
+import (
+	"blindwatermark/converter"
+	"blindwatermark/core"
+	"blindwatermark/internal/testimage"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	if err := NewBlindWatermarker().Validate(); err != nil {
+		t.Fatalf("default settings: %v", err)
+	}
+	for _, c := range []struct {
+		name string
+		opts []Option
+		want string // 错误信息中应包含的内容，空表示应当有效
+	}{
+		{"levels 8", []Option{WithLevels(core.MaxLevels)}, ""},
+		{"levels 9", []Option{WithLevels(core.MaxLevels + 1)}, "levels must be at most"},
+		{"levels 64", []Option{WithLevels(64)}, "levels must be at most"},
+		{"negative levels", []Option{WithLevels(-1)}, "levels must not be negative"},
+		{"NaN strength", []Option{WithStrength(math.NaN())}, "strength must be a finite number"},
+		{"Inf sync strength", []Option{WithSyncStrength(math.Inf(1))}, "sync_strength must be a finite number"},
+		{"-Inf target", []Option{WithTargetPSNR(math.Inf(-1))}, "target_psnr must be a finite number"},
+		{"NaN target", []Option{WithTargetPSNR(math.NaN())}, "target_psnr must be a finite number"},
+		{"NaN step", []Option{WithModulation(core.ModulationQIM, math.NaN())}, "step must be a finite number"},
+		{"zero strength", []Option{WithStrength(0)}, "strength must be positive"},
+		{"block size 5", []Option{WithBlockSize(5)}, "block_size must be 4, 8 or 16"},
+		{"pair outside 4x4", []Option{WithBlockSize(4), WithPairs([2][2]int{{4, 3}, {3, 4}})}, "outside the 4x4 block"},
+		{"self pair", []Option{WithPairs([2][2]int{{4, 3}, {4, 3}})}, "with itself"},
+		{"shared coefficient", []Option{WithBitsPerBlock(2), WithPairs([2][2]int{{4, 3}, {3, 4}}, [2][2]int{{4, 3}, {2, 5}})}, "shares a coefficient"},
+		{"5 default pairs", []Option{WithBitsPerBlock(5)}, ""},
+		{"6 bits per block", []Option{WithBitsPerBlock(6)}, "exceeds the number of pairs (5)"},
+		{"stdm bits", []Option{WithModulation(core.ModulationSTDM, 0), WithBitsPerBlock(2)}, "one bit per block"},
+		{"step with pair", []Option{WithModulation(core.ModulationPair, 10)}, "step only applies"},
+		{"target with qim", []Option{WithModulation(core.ModulationQIM, 0), WithTargetPSNR(40)}, "target_psnr only applies"},
+		{"chroma strength alone", []Option{WithChroma(0, 5)}, "no chroma channel"},
+		{"tile with one pair", []Option{WithTileSize(256), WithPairs([2][2]int{{4, 3}, {3, 4}})}, "at least two pairs"},
+		{"encryption key", []Option{WithEncryptionKey(make([]byte, 10))}, "16, 24 or 32 bytes"},
+	} {
+		err := NewBlindWatermarker(c.opts...).Validate()
+		switch {
+		case c.want == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", c.name, err)
+		case c.want != "" && (err == nil || !strings.Contains(err.Error(), c.want)):
+			t.Errorf("%s: got %v, want an error containing %q", c.name, err, c.want)
+		case err != nil && !errors.Is(err, ErrInvalidConfig):
+			t.Errorf("%s: %v does not wrap ErrInvalidConfig", c.name, err)
+		}
+	}
+
+	// 所有问题一起返回
+	err := NewBlindWatermarker(WithLevels(64), WithStrength(math.NaN()), WithBlockSize(5)).Validate()
+	if err == nil || strings.Count(err.Error(), ErrInvalidConfig.Error()) != 3 {
+		t.Errorf("got %v, want three joined errors", err)
+	}
+}
+
+// TestValidateBeforeEmbed 无效的设置在嵌入和提取时返回错误，而不是在变换中途 panic
+func TestValidateBeforeEmbed(t *testing.T) {
+	src := testimage.Photo(t, 256, 256)
+	// 配置错误先于尺寸、容量等检查报告
+	bw := NewBlindWatermarker(WithLevels(64))
+	for name, call := range map[string]func() error{
+		"embed text":    func() error { _, err := bw.EmbedText(src, "x"); return err },
+		"embed image":   func() error { _, err := bw.EmbedImage(src, src); return err },
+		"embed qr code": func() error { _, err := bw.EmbedQRCode(src, "x"); return err },
+		"extract":       func() error { _, err := bw.Extract(src); return err },
+		"resync":        func() error { _, err := bw.ExtractResync(src); return err },
+		"verify":        func() error { _, _, err := bw.VerifyExtract(src, nil); return err },
+	} {
+		if err := call(); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: got %v, want ErrInvalidConfig", name, err)
+		}
+	}
+
+	// 级数有效但底图太小：8 级、8x8 分块至少需要 2048x2048
+	deep := NewBlindWatermarker(WithLevels(8))
+	if _, err := deep.EmbedText(src, "x"); err == nil || !strings.Contains(err.Error(), "too small for 8 DWT levels") {
+		t.Errorf("embed text: got %v, want an image too small error", err)
+	}
+	if _, err := deep.EmbedImage(src, src); err == nil || !strings.Contains(err.Error(), "too small for 8 DWT levels") {
+		t.Errorf("embed image: got %v, want an image too small error", err)
+	}
+}
+
+// TestOptionOrder 选项按传入顺序应用，后面的覆盖前面的；FromConfig 的选项在配置之后应用
+func TestOptionOrder(t *testing.T) {
+	bw := NewBlindWatermarker(WithStrength(10), WithLevels(2), WithStrength(30))
+	if bw.engine.Strength != 30 || bw.engine.Levels != 2 {
+		t.Errorf("strength %v, levels %d; want 30 and 2", bw.engine.Strength, bw.engine.Levels)
+	}
+	bw = NewBlindWatermarker(WithChroma(core.ChannelCb, 5), WithChroma(0, 0))
+	if bw.engine.Chroma != 0 || bw.engine.ChromaStrength != 0 {
+		t.Errorf("chroma %v, strength %v after resetting", bw.engine.Chroma, bw.engine.ChromaStrength)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Strength = 10
+	bw, err := NewBlindWatermarkerFromConfig(cfg, WithStrength(25))
+	if err != nil || bw.engine.Strength != 25 {
+		t.Errorf("from config with option: strength %v, %v; want 25", bw.engine.Strength, err)
+	}
+	// 选项造成的无效组合同样被拒绝
+	if _, err := NewBlindWatermarkerFromConfig(cfg, WithLevels(9)); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("from config with an invalid option: got %v", err)
+	}
+}
+
+// TestConfigJSON 配置经 JSON 往返后不变，按它创建的 BlindWatermarker 给出同样的配置
+func TestConfigJSON(t *testing.T) {
+	cfg := Config{
+		Strength:       24,
+		SyncStrength:   1,
+		Subbands:       []string{"HL", "LH"},
+		Levels:         2,
+		Wavelet:        core.CDF97.Name(),
+		BlockSize:      16,
+		Pairs:          [][2][2]int{{{8, 6}, {6, 8}}, {{10, 4}, {4, 10}}},
+		BitsPerBlock:   2,
+		Modulation:     "pair",
+		Adaptive:       true,
+		Chroma:         []string{"cb", "cr"},
+		ChromaStrength: 8,
+		Redundant:      true,
+		Refine:         2,
+		TileSize:       512,
+		Workers:        3,
+		Key:            []byte("secret layout key"),
+		FEC:            "reed-solomon",
+		FECLevel:       4,
+		CompactHeader:  true,
+		Compress:       true,
+		Stream:         true,
+		TargetPSNR:     42,
+		WaveletSearch:  true,
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := DefaultConfig()
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, cfg) {
+		t.Fatalf("JSON round trip:\n got %+v\nwant %+v", got, cfg)
+	}
+	bw, err := NewBlindWatermarkerFromConfig(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back := bw.Config(); !reflect.DeepEqual(back, cfg) {
+		t.Errorf("Config() of the built watermarker:\n got %+v\nwant %+v", back, cfg)
+	}
+
+	// 文件中没有的字段保持默认值
+	partial := DefaultConfig()
+	if err := json.Unmarshal([]byte(`{"levels": 3, "fec": "convolutional", "modulation": "stdm"}`), &partial); err != nil {
+		t.Fatal(err)
+	}
+	bw, err = NewBlindWatermarkerFromConfig(partial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bw.engine.Levels != 3 || bw.engine.Refine != 2 || bw.engine.Modulation != core.ModulationSTDM || bw.FEC.ID() != converter.CodecConvolutional {
+		t.Errorf("partial config: %+v", bw.Config())
+	}
+
+	// 无法识别的名称
+	for _, js := range []string{`{"wavelet": "sym8"}`, `{"fec": "ldpc"}`, `{"subbands": ["LL"]}`, `{"modulation": "ss"}`, `{"chroma": ["alpha"]}`} {
+		c := DefaultConfig()
+		if err := json.Unmarshal([]byte(js), &c); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Validate(); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: got %v, want ErrInvalidConfig", js, err)
+		}
+	}
+}
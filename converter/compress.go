@@ -0,0 +1,47 @@
+package converter
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+)
+
+// FlagCompressed 类型字节的标志位，表示数据经过 DEFLATE 压缩
+// 压缩在加密之前进行，密文几乎不可压缩
+const FlagCompressed WatermarkType = 0x20
+
+// maxDecompressedLen 解压后的最大字节数，防止损坏或恶意构造的数据占用过多内存
+const maxDecompressedLen = 1 << 20
+
+// ErrDecompress 压缩数据无法解压
+var ErrDecompress = errors.New("watermark decompression failed")
+
+// Compressed 数据是否经过压缩
+func (t WatermarkType) Compressed() bool {
+	return t&FlagCompressed != 0
+}
+
+// Compress 用 DEFLATE 压缩 data
+// 压缩后没有变短时返回 ok = false，调用方应保留原始数据且不设置 FlagCompressed
+func Compress(data []byte) (compressed []byte, ok bool) {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.BestCompression)
+	w.Write(data)
+	w.Close()
+	if buf.Len() >= len(data) {
+		return data, false
+	}
+	return buf.Bytes(), true
+}
+
+// Decompress 解压 Compress 生成的数据
+func Decompress(compressed []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(compressed))
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, maxDecompressedLen+1))
+	if err != nil || len(data) > maxDecompressedLen {
+		return nil, ErrDecompress
+	}
+	return data, nil
+}
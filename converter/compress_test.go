@@ -0,0 +1,59 @@
+package converter
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	data := []byte(strings.Repeat("https://example.com/user/42 ", 8))
+	compressed, ok := Compress(data)
+	if !ok || len(compressed) >= len(data) {
+		t.Fatalf("repetitive text: ok %v, %d -> %d bytes", ok, len(data), len(compressed))
+	}
+	got, err := Decompress(compressed)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Decompress = %q, %v", got, err)
+	}
+
+	// 短文本压缩后反而变长，原样返回
+	short := []byte("id:42")
+	if got, ok := Compress(short); ok || !bytes.Equal(got, short) {
+		t.Errorf("short text: ok %v, got %q", ok, got)
+	}
+}
+
+func TestDecompressRejects(t *testing.T) {
+	if _, err := Decompress([]byte{0xff, 0x00, 0x12}); !errors.Is(err, ErrDecompress) {
+		t.Errorf("garbage: got %v, want ErrDecompress", err)
+	}
+	bomb, _ := Compress(make([]byte, maxDecompressedLen+1))
+	if _, err := Decompress(bomb); !errors.Is(err, ErrDecompress) {
+		t.Errorf("oversized: got %v, want ErrDecompress", err)
+	}
+}
+
+// TestCompactHeader 紧凑头部对短载荷只占 2 字节，比标准头部少 4 字节
+func TestCompactHeader(t *testing.T) {
+	for _, codec := range []Codec{nil, NewConvolutional()} {
+		c := codec
+		if c == nil {
+			c = plainCodec{}
+		}
+		if got, want := PackedLen(codec, 20)-CompactPackedLen(codec, 20), c.EncodedLen(headerLen)-c.EncodedLen(2); got != want {
+			t.Errorf("codec %v: compact header saves %d bits, want %d", codec, got, want)
+		}
+		if n := len(PackCompact(TypeText, make([]byte, 20), codec)); n != CompactPackedLen(codec, 20) {
+			t.Errorf("codec %v: packed %d bits, CompactPackedLen says %d", codec, n, CompactPackedLen(codec, 20))
+		}
+	}
+	// 长度跨越 uvarint 的字节边界
+	for _, n := range []int{0, 127, 128, 16383, 16384} {
+		frame, err := DecodeFrame(boolsToSoft(PackCompact(TypeImage, make([]byte, n), nil)))
+		if err != nil || len(frame.Data) != n {
+			t.Errorf("length %d: %v", n, err)
+		}
+	}
+}
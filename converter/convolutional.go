@@ -0,0 +1,111 @@
+package converter
+
+import (
+	"math"
+	"math/bits"
+)
+
+// 卷积码参数：约束长度 K=7，码率 1/2，生成多项式 171/133 (八进制)，与 CCSDS / 802.11 相同
+const (
+	convK      = 7
+	convStates = 1 << (convK - 1)
+	convPoly0  = 0o171
+	convPoly1  = 0o133
+)
+
+// Convolutional 比特级卷积码 + Viterbi 译码，适合随机分布的比特翻转
+type Convolutional struct{}
+
+// NewConvolutional 创建卷积码编码器
+func NewConvolutional() *Convolutional {
+	return &Convolutional{}
+}
+
+func (c *Convolutional) ID() CodecID { return CodecConvolutional }
+
+// Level 卷积码码率固定为 1/2，没有可调的冗余等级
+func (c *Convolutional) Level() int { return 0 }
+
+// EncodedLen 每个输入 bit 产生 2 个输出 bit，末尾补 K-1 个 0 让编码器回到零状态
+func (c *Convolutional) EncodedLen(n int) int {
+	return 2 * (n*8 + convK - 1)
+}
+
+func (c *Convolutional) Encode(data []byte) []bool {
+	input := append(bytesToBits(data), make([]bool, convK-1)...)
+	out := make([]bool, 0, 2*len(input))
+	state := 0
+	for _, b := range input {
+		reg := state
+		if b {
+			reg |= 1 << (convK - 1)
+		}
+		out = append(out, convParity(reg&convPoly0), convParity(reg&convPoly1))
+		state = reg >> 1
+	}
+	return out
+}
+
+// Decode Viterbi 软判决译码：路径度量为软判决值与期望符号 (±1) 的相关值，取最大者
+func (c *Convolutional) Decode(received []float64, n int) ([]byte, error) {
+	steps := n*8 + convK - 1
+	received = received[:2*steps]
+
+	metric := make([]float64, convStates)
+	for s := 1; s < convStates; s++ {
+		metric[s] = math.Inf(-1)
+	}
+	next := make([]float64, convStates)
+	// decisions[t][s] 记录到达状态 s 时被移出寄存器的那一位，用于回溯
+	decisions := make([][convStates]bool, steps)
+
+	for t := 0; t < steps; t++ {
+		r0, r1 := received[2*t], received[2*t+1]
+		for s := range next {
+			next[s] = math.Inf(-1)
+		}
+		for s := 0; s < convStates; s++ {
+			if math.IsInf(metric[s], -1) {
+				continue
+			}
+			for _, in := range []int{0, 1} {
+				reg := s | in<<(convK-1)
+				gain := metric[s] + signed(convParity(reg&convPoly0), r0) + signed(convParity(reg&convPoly1), r1)
+				ns := reg >> 1
+				if gain > next[ns] {
+					next[ns] = gain
+					decisions[t][ns] = s&1 == 1
+				}
+			}
+		}
+		metric, next = next, metric
+	}
+
+	// 尾比特保证终止于零状态，从零状态回溯
+	out := make([]bool, steps)
+	state := 0
+	for t := steps - 1; t >= 0; t-- {
+		out[t] = state>>(convK-2)&1 == 1
+		state = (state<<1)&(convStates-1) | boolToInt(decisions[t][state])
+	}
+	return bitsToBytes(out[:n*8]), nil
+}
+
+// signed 期望输出为 1 时返回 r，为 0 时返回 -r
+func signed(bit bool, r float64) float64 {
+	if bit {
+		return r
+	}
+	return -r
+}
+
+func convParity(x int) bool {
+	return bits.OnesCount(uint(x))%2 == 1
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
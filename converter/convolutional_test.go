@@ -0,0 +1,69 @@
+package converter
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestConvolutionalRoundTrip(t *testing.T) {
+	c := NewConvolutional()
+	data := randomBytes(100, 1)
+	encoded := c.Encode(data)
+	if len(encoded) != c.EncodedLen(len(data)) {
+		t.Fatalf("encoded %d bits, EncodedLen says %d", len(encoded), c.EncodedLen(len(data)))
+	}
+	got, err := c.Decode(toSoft(encoded), len(data))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("round trip failed: %v", err)
+	}
+}
+
+// TestConvolutionalHardErrors 2% 的随机比特翻转 (硬判决，所有位置信度相同) 应被完全纠正
+func TestConvolutionalHardErrors(t *testing.T) {
+	c := NewConvolutional()
+	for seed := range uint64(20) {
+		data := randomBytes(64, seed)
+		soft := toSoft(c.Encode(data))
+		rng := rand.New(rand.NewPCG(seed, 1))
+		for i := range soft {
+			if rng.Float64() < 0.02 {
+				soft[i] = -soft[i]
+			}
+		}
+		got, err := c.Decode(soft, len(data))
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("seed %d: not corrected: %v", seed, err)
+		}
+	}
+}
+
+// TestConvolutionalSoftErrors 高斯噪声下的软判决译码：原始误码率约 10% 时，译码后的误码率应降到 1% 以下
+func TestConvolutionalSoftErrors(t *testing.T) {
+	c := NewConvolutional()
+	data := randomBytes(1000, 2)
+	soft := toSoft(c.Encode(data))
+	rng := rand.New(rand.NewPCG(2, 2))
+	raw := 0
+	for i, v := range soft {
+		soft[i] = v + 0.78*rng.NormFloat64()
+		if (soft[i] >= 0) != (v >= 0) {
+			raw++
+		}
+	}
+	got, err := c.Decode(soft, len(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := 0
+	for i, b := range bytesToBits(got) {
+		if b != bytesToBits(data)[i] {
+			errs++
+		}
+	}
+	rawBER, ber := float64(raw)/float64(len(soft)), float64(errs)/float64(len(data)*8)
+	t.Logf("raw BER %.4f, decoded BER %.4f", rawBER, ber)
+	if rawBER < 0.08 || ber > 0.01 {
+		t.Errorf("raw BER %.4f, decoded BER %.4f", rawBER, ber)
+	}
+}
@@ -0,0 +1,66 @@
+package converter
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+)
+
+// FlagEncrypted 类型字节的最高位，表示载荷经过 AES-GCM 认证加密
+// 加密后的载荷结构: [Nonce(12 bytes)] + [Ciphertext] + [Tag(16 bytes)]
+const FlagEncrypted WatermarkType = 0x80
+
+// SealOverhead 加密带来的额外字节数 (Nonce + Tag)
+const SealOverhead = 12 + 16
+
+var (
+	// ErrKeyRequired 水印已加密，但没有提供密钥
+	ErrKeyRequired = errors.New("watermark is encrypted, key required")
+	// ErrAuthFailed 认证失败：密钥错误，或水印数据被篡改 / 损坏
+	ErrAuthFailed = errors.New("watermark authentication failed")
+)
+
+// Encrypted 是否为加密载荷
+func (t WatermarkType) Encrypted() bool {
+	return t&FlagEncrypted != 0
+}
+
+// Seal 使用 AES-GCM 加密 data，key 长度为 16 / 24 / 32 字节
+// 类型字节 wmType 作为附加认证数据，防止被替换
+func Seal(key []byte, wmType WatermarkType, data []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, []byte{byte(wmType)}), nil
+}
+
+// Open 解密并校验 Seal 生成的载荷，认证失败时返回 ErrAuthFailed
+func Open(key []byte, wmType WatermarkType, sealed []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrAuthFailed
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	data, err := aead.Open(nil, nonce, ciphertext, []byte{byte(wmType)})
+	if err != nil {
+		return nil, ErrAuthFailed
+	}
+	return data, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,63 @@
+package converter
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+var testKey = []byte("0123456789abcdef")
+
+func TestSealOpen(t *testing.T) {
+	data := []byte("hello")
+	sealed, err := Seal(testKey, TypeText|FlagEncrypted, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sealed) != len(data)+SealOverhead {
+		t.Errorf("sealed %d bytes, want %d", len(sealed), len(data)+SealOverhead)
+	}
+	got, err := Open(testKey, TypeText|FlagEncrypted, sealed)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Open = %q, %v", got, err)
+	}
+
+	// 每次使用新的随机 nonce，相同明文的密文不同
+	again, _ := Seal(testKey, TypeText|FlagEncrypted, data)
+	if bytes.Equal(sealed, again) {
+		t.Error("two seals of the same data are identical")
+	}
+}
+
+func TestOpenRejects(t *testing.T) {
+	sealed, _ := Seal(testKey, TypeText|FlagEncrypted, []byte("hello"))
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)/2] ^= 1
+
+	for _, c := range []struct {
+		name   string
+		key    []byte
+		wmType WatermarkType
+		sealed []byte
+	}{
+		{"wrong key", []byte("fedcba9876543210"), TypeText | FlagEncrypted, sealed},
+		{"tampered", testKey, TypeText | FlagEncrypted, tampered},
+		{"type swapped", testKey, TypeQRCode | FlagEncrypted, sealed},
+		{"truncated", testKey, TypeText | FlagEncrypted, sealed[:SealOverhead-1]},
+	} {
+		if _, err := Open(c.key, c.wmType, c.sealed); !errors.Is(err, ErrAuthFailed) {
+			t.Errorf("%s: got %v, want ErrAuthFailed", c.name, err)
+		}
+	}
+}
+
+func TestSealKeySize(t *testing.T) {
+	for _, n := range []int{16, 24, 32} {
+		if _, err := Seal(make([]byte, n), TypeText, nil); err != nil {
+			t.Errorf("%d-byte key: %v", n, err)
+		}
+	}
+	if _, err := Seal(make([]byte, 10), TypeText, nil); err == nil {
+		t.Error("10-byte key: expected an error")
+	}
+}
@@ -0,0 +1,77 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CodecID 纠错编码方案
+type CodecID byte
+
+const (
+	CodecNone          CodecID = 0x00
+	CodecReedSolomon   CodecID = 0x01
+	CodecConvolutional CodecID = 0x02
+)
+
+// Codec 纠错编码 (FEC) 接口，位于 Pack 与 Engine.Embed 之间
+type Codec interface {
+	// ID 编码方案
+	ID() CodecID
+	// Level 冗余等级 (0-15)，与 ID 一起记录在头部，解码时据此重建 Codec
+	Level() int
+	// Encode 将字节数据编码为 bits
+	Encode(data []byte) []bool
+	// EncodedLen 返回 n 字节数据编码后的 bit 数
+	EncodedLen(n int) int
+	// Decode 从软判决值中解出 n 字节数据，soft 长度至少为 EncodedLen(n)
+	// soft[i] > 0 表示第 i 位更可能是 1，绝对值越大越可信
+	Decode(soft []float64, n int) ([]byte, error)
+}
+
+var (
+	// ErrUncorrectable 错误过多，纠错码无法恢复
+	ErrUncorrectable = errors.New("too many errors to correct")
+	// ErrUnknownCodec 头部记录的编码方案不是已知的 CodecID
+	ErrUnknownCodec = errors.New("unknown codec")
+)
+
+// NewCodec 根据编码方案和冗余等级创建 Codec
+func NewCodec(id CodecID, level int) (Codec, error) {
+	switch id {
+	case CodecNone:
+		return plainCodec{}, nil
+	case CodecReedSolomon:
+		return NewReedSolomon(level)
+	case CodecConvolutional:
+		return NewConvolutional(), nil
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnknownCodec, id)
+	}
+}
+
+// plainCodec 不做纠错，未指定 FEC 时 v2 帧使用它，使帧结构保持一致
+type plainCodec struct{}
+
+func (plainCodec) ID() CodecID { return CodecNone }
+
+func (plainCodec) Level() int { return 0 }
+
+func (plainCodec) Encode(data []byte) []bool { return bytesToBits(data) }
+
+func (plainCodec) EncodedLen(n int) int { return n * 8 }
+
+func (plainCodec) Decode(soft []float64, n int) ([]byte, error) {
+	return bitsToBytes(softToBools(soft[:n*8])), nil
+}
+
+// PackWithCodec 同 Pack，但头部和数据都经过纠错编码
+// codec 为 nil 时等价于 Pack
+func PackWithCodec(wmType WatermarkType, data []byte, codec Codec) []bool {
+	return packFrame(wmType, data, codec, false)
+}
+
+// PackedLen 返回 n 字节数据打包后的总 bit 数
+func PackedLen(codec Codec, n int) int {
+	return packedLen(codec, n, false)
+}
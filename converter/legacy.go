@@ -0,0 +1,53 @@
+package converter
+
+import (
+	"encoding/binary"
+)
+
+// v1 协议 (旧版本嵌入的水印，只解码不再生成)
+//
+//	[Type(1 byte)] + [Length(4 bytes)] + [Data]
+//
+// v1 没有同步字、纠错和校验，无法区分“没有水印”和“水印已损坏”，解析失败一律视为 ErrNoWatermark。
+// 类型字节只可能是 TypeText、TypeImage、TypeQRCode 之一：加密、签名等标志位是 v2 才有的
+const v1HeaderLen = 5
+
+// packV1 按 v1 协议打包，用于还原旧水印的原始比特
+func packV1(wmType WatermarkType, data []byte) []bool {
+	header := make([]byte, v1HeaderLen)
+	header[0] = byte(wmType)
+	binary.BigEndian.PutUint32(header[1:5], uint32(len(data)))
+	return bytesToBits(append(header, data...))
+}
+
+func v1PackedLen(n int) int {
+	return (v1HeaderLen + n) * 8
+}
+
+// readV1Header 解析 v1 头部，返回类型和数据长度
+func readV1Header(soft []float64) (WatermarkType, int, error) {
+	if len(soft) < v1HeaderLen*8 {
+		return 0, 0, ErrNoWatermark
+	}
+	header := bitsToBytes(softToBools(soft[:v1HeaderLen*8]))
+
+	// 不带任何标志位的已知类型之外都是噪声：v1 帧没有校验，放宽一点误判的概率就成倍增加
+	wmType := WatermarkType(header[0])
+	if !wmType.Known() {
+		return 0, 0, ErrNoWatermark
+	}
+	return wmType, int(binary.BigEndian.Uint32(header[1:5])), nil
+}
+
+// decodeV1 解析 v1 帧
+func decodeV1(soft []float64) (*Frame, error) {
+	wmType, length, err := readV1Header(soft)
+	if err != nil {
+		return nil, err
+	}
+	if v1PackedLen(length) > len(soft) {
+		return nil, ErrNoWatermark
+	}
+	data := bitsToBytes(softToBools(soft[v1HeaderLen*8 : (v1HeaderLen+length)*8]))
+	return &Frame{Version: Version1, Type: wmType, Data: data, Bits: packV1(wmType, data)}, nil
+}
@@ -0,0 +1,37 @@
+package converter
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecodeV1(t *testing.T) {
+	bits := packV1(TypeText, []byte("legacy"))
+	frame, err := DecodeFrame(boolsToSoft(append(bits, make([]bool, 64)...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.Version != Version1 || frame.Type != TypeText || string(frame.Data) != "legacy" {
+		t.Errorf("got %+v", frame)
+	}
+	if n, err := FrameLen(boolsToSoft(bits)); err != nil || n != len(bits) {
+		t.Errorf("FrameLen = %d, %v, want %d", n, err, len(bits))
+	}
+}
+
+func TestDecodeV1Rejects(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		bits []bool
+	}{
+		{"unknown type", packV1(0x07, []byte("legacy"))},
+		{"encrypted flag", packV1(TypeText|FlagEncrypted, []byte("legacy"))},
+		{"signed flag", packV1(TypeImage|FlagSigned, []byte("legacy"))},
+		{"truncated", packV1(TypeText, []byte("legacy"))[:v1HeaderLen*8+8]},
+		{"too short", make([]bool, v1HeaderLen*8-1)},
+	} {
+		if _, err := DecodeFrame(boolsToSoft(c.bits)); !errors.Is(err, ErrNoWatermark) {
+			t.Errorf("%s: got %v, want ErrNoWatermark", c.name, err)
+		}
+	}
+}
@@ -1,8 +1,13 @@
 package converter
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"math/bits"
 )
 
 // WatermarkType 定义水印类型
@@ -14,40 +19,288 @@ const (
 	TypeQRCode WatermarkType = 0x03
 )
 
+// flagMask 类型字节的高 4 位为标志位 (FlagEncrypted、FlagSigned、FlagCompressed)，低 4 位为基本类型
+const flagMask WatermarkType = 0xF0
+
+// Base 去掉标志位后的基本类型 (TypeText / TypeImage / TypeQRCode)
+func (t WatermarkType) Base() WatermarkType {
+	return t &^ flagMask
+}
+
+// Known 是否为已定义的基本类型
+func (t WatermarkType) Known() bool {
+	switch t {
+	case TypeText, TypeImage, TypeQRCode:
+		return true
+	}
+	return false
+}
+
+// 协议版本
+const (
+	Version1 = 1 // [Type] + [Length] + [Data]，没有同步字和校验，见 legacy.go
+	Version2 = 2
+)
+
+// v2 协议结构:
+//
+//	[Magic(2 bytes)] + [Version(1 byte) + Codec(1 byte)] x3
+//	+ Codec([Header]) + Codec([Data] + [CRC32(4 bytes)])
+//
+// Magic 和 Version/Codec 不经过纠错编码：Magic 按汉明距离匹配，用于判断图中是否有水印；
+// Version/Codec 重复 3 次按位表决，Codec = ID<<4 | Level
+// Version 字节的低 4 位为版本号，最高位 (compactFlag) 表示头部为紧凑格式：
+//
+//	标准: [Type(1 byte)] + [Flags(1 byte)] + [Length(4 bytes)]
+//	紧凑: [Flags(4 bits) | Type(4 bits)] + [Length(uvarint, 1-5 bytes)]
+//
+// 紧凑格式下 Version 字节的第 4-6 位记录 uvarint 的字节数，解码时无需试探头部长度
+//
+// Flags 为类型字节的标志位，CRC32 覆盖头部和数据
+const (
+	descriptorRepeats = 3
+	headerLen         = 6
+	checksumLen       = 4
+	versionMask       = 0x0F
+	compactFlag       = 0x80
+	compactSizeMask   = 0x70
+	// magicTolerance Magic 允许的最大错误位数，随机数据误判的概率约为 1%
+	magicTolerance = 3
+	preambleBits   = len(magic)*8 + descriptorRepeats*16
+)
+
+var magic = [2]byte{0xB7, 0x4D}
+
+var (
+	// ErrNoWatermark 图中没有 (可识别的) 水印
+	ErrNoWatermark = errors.New("no watermark found")
+	// ErrChecksumMismatch 找到了水印，但内容已损坏
+	ErrChecksumMismatch = errors.New("watermark checksum mismatch")
+	// ErrUnsupportedVersion 水印由更新版本的协议生成
+	ErrUnsupportedVersion = errors.New("unsupported watermark protocol version")
+)
+
 // Pack 将原始数据加上头部信息，并转换为 bool 数组（用于嵌入）
-// 协议结构: [Type(1 byte)] + [Length(4 bytes)] + [Data]
+// 协议结构见上方 v2 说明，不做纠错编码
 func Pack(wmType WatermarkType, data []byte) []bool {
-	// 1. 构建二进制 Buffer
-	length := uint32(len(data))
-	buf := make([]byte, 1+4+len(data))
-
-	buf[0] = byte(wmType)
-	binary.BigEndian.PutUint32(buf[1:5], length)
-	copy(buf[5:], data)
+	return PackWithCodec(wmType, data, nil)
+}
 
-	// 2. 将 []byte 转换为 []bool (bits)
-	return bytesToBits(buf)
+// Frame 解析出的一帧水印
+type Frame struct {
+	Version int
+	Type    WatermarkType
+	Data    []byte
+	// Bits 按原编码方式重新打包得到的整帧，与嵌入时写入的 bits 一致，
+	// 可以和提取出的原始比特逐位比对，估计信道误码率
+	Bits []bool
 }
 
 // Unpack 从提取出的 bool 数组中还原数据，并解析类型
+// 自动识别协议版本和纠错编码
 func Unpack(bits []bool) (WatermarkType, []byte, error) {
-	bytesData := bitsToBytes(bits)
+	frame, err := DecodeFrame(boolsToSoft(bits))
+	if err != nil {
+		return 0, nil, err
+	}
+	return frame.Type, frame.Data, nil
+}
 
-	if len(bytesData) < 5 {
-		return 0, nil, errors.New("extracted data too short")
+// UnpackSoft 同 Unpack，输入为软判决值
+// soft[i] > 0 表示第 i 位更可能是 1，绝对值越大越可信；纠错译码会利用这些置信度
+func UnpackSoft(soft []float64) (WatermarkType, []byte, error) {
+	frame, err := DecodeFrame(soft)
+	if err != nil {
+		return 0, nil, err
 	}
+	return frame.Type, frame.Data, nil
+}
 
-	// 1. 解析头部
-	wmType := WatermarkType(bytesData[0])
-	length := binary.BigEndian.Uint32(bytesData[1:5])
+// PackCompact 同 PackWithCodec，但使用紧凑头部：长度为 uvarint，短载荷的头部只占 2 字节
+func PackCompact(wmType WatermarkType, data []byte, codec Codec) []bool {
+	return packFrame(wmType, data, codec, true)
+}
 
-	// 2. 校验长度
-	totalLen := 5 + int(length)
-	if len(bytesData) < totalLen {
-		return 0, nil, errors.New("data corrupted or incomplete")
+// CompactPackedLen 返回 n 字节数据按 PackCompact 打包后的总 bit 数
+func CompactPackedLen(codec Codec, n int) int {
+	return packedLen(codec, n, true)
+}
+
+func packFrame(wmType WatermarkType, data []byte, codec Codec, compact bool) []bool {
+	if codec == nil {
+		codec = plainCodec{}
+	}
+	header := headerBytes(wmType, len(data), compact)
+
+	descriptor := []byte{Version2, byte(codec.ID())<<4 | byte(codec.Level())}
+	if compact {
+		descriptor[0] |= compactFlag | byte(len(header)-1)<<4
+	}
+	bits := make([]bool, 0, packedLen(codec, len(data), compact))
+	bits = append(bits, bytesToBits(magic[:])...)
+	for i := 0; i < descriptorRepeats; i++ {
+		bits = append(bits, bytesToBits(descriptor)...)
+	}
+	bits = append(bits, codec.Encode(header)...)
+	return append(bits, codec.Encode(appendChecksum(header, data))...)
+}
+
+func packedLen(codec Codec, n int, compact bool) int {
+	if codec == nil {
+		codec = plainCodec{}
+	}
+	size := headerLen
+	if compact {
+		size = 1 + uvarintLen(n)
+	}
+	return preambleBits + codec.EncodedLen(size) + codec.EncodedLen(n+checksumLen)
+}
+
+// DecodeFrame 从软判决值中解析出一帧水印
+// 开头没有 Magic 时按 v1 协议解析；都失败时返回 ErrNoWatermark
+func DecodeFrame(soft []float64) (*Frame, error) {
+	if !hasMagic(soft) {
+		return decodeV1(soft)
+	}
+
+	h, err := readHeader(soft)
+	if err != nil {
+		return nil, err
+	}
+	if h.frameLen() > len(soft) {
+		return nil, fmt.Errorf("%w: data corrupted or incomplete", ErrChecksumMismatch)
 	}
 
-	return wmType, bytesData[5:totalLen], nil
+	start := preambleBits + h.codec.EncodedLen(len(h.raw))
+	body, err := h.codec.Decode(soft[start:start+h.codec.EncodedLen(h.length+checksumLen)], h.length+checksumLen)
+	if err != nil {
+		return nil, fmt.Errorf("%w: data: %w", ErrChecksumMismatch, err)
+	}
+	data := body[:h.length]
+	if !bytes.Equal(appendChecksum(h.raw, data)[h.length:], body[h.length:]) {
+		return nil, ErrChecksumMismatch
+	}
+	return &Frame{Version: Version2, Type: h.wmType, Data: data, Bits: packFrame(h.wmType, data, h.codec, h.compact)}, nil
+}
+
+// hasMagic 开头的 Magic 与预期相差不超过 magicTolerance 位
+func hasMagic(soft []float64) bool {
+	if len(soft) < preambleBits {
+		return false
+	}
+	got := bitsToBytes(softToBools(soft[:len(magic)*8]))
+	diff := 0
+	for i := range magic {
+		diff += bits.OnesCount8(got[i] ^ magic[i])
+	}
+	return diff <= magicTolerance
+}
+
+// frameHeader 解析出的 v2 前导和头部
+type frameHeader struct {
+	codec   Codec
+	compact bool
+	wmType  WatermarkType
+	length  int
+	raw     []byte // 头部原始字节，参与 CRC 计算
+}
+
+// frameLen 整帧的 bit 数
+func (h *frameHeader) frameLen() int {
+	return packedLen(h.codec, h.length, h.compact)
+}
+
+// readHeader 解析 v2 帧的前导和头部
+// Magic 已经匹配，之后的失败都说明水印存在但已损坏，返回 ErrChecksumMismatch；
+// 只有 3 份描述字节完全一致、却记录了未知的版本或编码方案时，才认为是更新的协议 (ErrUnsupportedVersion)
+func readHeader(soft []float64) (*frameHeader, error) {
+	copies := soft[len(magic)*8 : preambleBits]
+	descriptor := bitsToBytes(softToBools(VoteSoft(copies, 16, 16)))
+	first, unanimous := bitsToBytes(softToBools(copies[:16])), true
+	for i := 1; i < descriptorRepeats; i++ {
+		if !bytes.Equal(bitsToBytes(softToBools(copies[i*16:i*16+16])), first) {
+			unanimous = false
+		}
+	}
+	corrupt := ErrChecksumMismatch
+	if unanimous {
+		corrupt = ErrUnsupportedVersion
+	}
+
+	if version := descriptor[0] & versionMask; version != Version2 {
+		return nil, fmt.Errorf("%w: version %d", corrupt, version)
+	}
+	codec, err := NewCodec(CodecID(descriptor[1]>>4), int(descriptor[1]&0x0F))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", corrupt, err)
+	}
+	h := &frameHeader{codec: codec, compact: descriptor[0]&compactFlag != 0}
+
+	soft = soft[preambleBits:]
+	if !h.compact {
+		if h.raw, err = decodeHeader(soft, codec, headerLen); err != nil {
+			return nil, err
+		}
+		h.wmType = WatermarkType(h.raw[0] | h.raw[1])
+		h.length = int(binary.BigEndian.Uint32(h.raw[2:6]))
+		return h, nil
+	}
+
+	size := 1 + int(descriptor[0]&compactSizeMask>>4)
+	if size < 2 {
+		return nil, fmt.Errorf("%w: header size %d", ErrChecksumMismatch, size)
+	}
+	if h.raw, err = decodeHeader(soft, codec, size); err != nil {
+		return nil, err
+	}
+	length, n := binary.Uvarint(h.raw[1:])
+	if n != size-1 || length > math.MaxUint32 {
+		return nil, fmt.Errorf("%w: header length", ErrChecksumMismatch)
+	}
+	h.wmType, h.length = WatermarkType(h.raw[0]), int(length)
+	return h, nil
+}
+
+// decodeHeader 解出 size 字节的头部
+func decodeHeader(soft []float64, codec Codec, size int) ([]byte, error) {
+	headerBits := codec.EncodedLen(size)
+	if len(soft) < headerBits {
+		return nil, fmt.Errorf("%w: extracted data too short", ErrChecksumMismatch)
+	}
+	header, err := codec.Decode(soft[:headerBits], size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: header: %w", ErrChecksumMismatch, err)
+	}
+	return header, nil
+}
+
+// headerBytes 构造 v2 头部，格式见上方说明
+func headerBytes(wmType WatermarkType, length int, compact bool) []byte {
+	if compact {
+		return binary.AppendUvarint([]byte{byte(wmType)}, uint64(length))
+	}
+	header := make([]byte, headerLen)
+	header[0] = byte(wmType.Base())
+	header[1] = byte(wmType &^ wmType.Base())
+	binary.BigEndian.PutUint32(header[2:6], uint32(length))
+	return header
+}
+
+// uvarintLen n 按 uvarint 编码后的字节数
+func uvarintLen(n int) int {
+	size := 1
+	for ; n >= 0x80; n >>= 7 {
+		size++
+	}
+	return size
+}
+
+// appendChecksum 返回 data + CRC32(header + data)
+func appendChecksum(header, data []byte) []byte {
+	crc := crc32.NewIEEE()
+	crc.Write(header)
+	crc.Write(data)
+	return crc.Sum(append(make([]byte, 0, len(data)+checksumLen), data...))
 }
 
 // 辅助：byte 转 bit
@@ -77,3 +330,25 @@ func bitsToBytes(bits []bool) []byte {
 	}
 	return data
 }
+
+// 辅助：bit 转软判决值 (+1 / -1)
+func boolsToSoft(bits []bool) []float64 {
+	soft := make([]float64, len(bits))
+	for i, b := range bits {
+		if b {
+			soft[i] = 1
+		} else {
+			soft[i] = -1
+		}
+	}
+	return soft
+}
+
+// 辅助：软判决值转 bit (硬判决)，0 视为 1，与 Engine.Extract 一致
+func softToBools(soft []float64) []bool {
+	bits := make([]bool, len(soft))
+	for i, v := range soft {
+		bits[i] = v >= 0
+	}
+	return bits
+}
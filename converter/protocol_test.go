@@ -0,0 +1,114 @@
+package converter
+
+import (
+	"bytes"
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestPackUnpack(t *testing.T) {
+	rs, _ := NewReedSolomon(2)
+	for _, codec := range []Codec{nil, rs, NewConvolutional()} {
+		for _, compact := range []bool{false, true} {
+			data := []byte("hello, watermark")
+			bits := PackWithCodec(TypeQRCode, data, codec)
+			if compact {
+				bits = PackCompact(TypeQRCode, data, codec)
+			}
+			frame, err := DecodeFrame(boolsToSoft(bits))
+			if err != nil {
+				t.Fatalf("codec %v compact %v: %v", codec, compact, err)
+			}
+			if frame.Version != Version2 || frame.Type != TypeQRCode || !bytes.Equal(frame.Data, data) {
+				t.Errorf("codec %v compact %v: got %+v", codec, compact, frame)
+			}
+			if !slices.Equal(frame.Bits, bits) {
+				t.Errorf("codec %v compact %v: Frame.Bits differs from the packed bits", codec, compact)
+			}
+		}
+	}
+}
+
+func TestDecodeFrameNoise(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 1))
+	misses := 0
+	for range 100 {
+		soft := make([]float64, 2000)
+		for i := range soft {
+			soft[i] = rng.NormFloat64()
+		}
+		if _, err := DecodeFrame(soft); errors.Is(err, ErrNoWatermark) {
+			misses++
+		} else if err == nil {
+			t.Fatal("decoded a frame from noise")
+		}
+	}
+	// Magic 允许 3 位误差，随机数据约有 1% 的概率误判为有水印，之后由 CRC 拦下
+	if misses < 95 {
+		t.Errorf("only %d of 100 noise inputs reported ErrNoWatermark", misses)
+	}
+}
+
+func TestDecodeFrameChecksum(t *testing.T) {
+	soft := boolsToSoft(Pack(TypeText, []byte("hello")))
+	soft[len(soft)-40] = -soft[len(soft)-40]
+	if _, err := DecodeFrame(soft); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("got %v, want ErrChecksumMismatch", err)
+	}
+}
+
+// flipDescriptor 把第 copies 份描述字节中的第 bit 位取反 (0-15，从 Version 字节的最高位数起)
+func flipDescriptor(soft []float64, bit int, copies ...int) {
+	for _, c := range copies {
+		i := len(magic)*8 + c*16 + bit
+		soft[i] = -soft[i]
+	}
+}
+
+func TestReadHeaderDescriptor(t *testing.T) {
+	const (
+		versionLSB = 7  // Version2 = 0x02 的最低位，取反后为 3
+		versionBit = 4  // 0x08，取反后为 10
+		codecBit   = 9  // Codec 字节的 0x40，取反后 ID 为 4
+		codecBit2  = 10 // Codec 字节的 0x20
+	)
+	for _, c := range []struct {
+		name  string
+		flips func(soft []float64)
+		want  []error
+	}{
+		{"one copy damaged", func(s []float64) { flipDescriptor(s, versionLSB, 1) }, nil},
+		{"newer version", func(s []float64) { flipDescriptor(s, versionLSB, 0, 1, 2) }, []error{ErrUnsupportedVersion}},
+		{"copies disagree", func(s []float64) {
+			flipDescriptor(s, versionBit, 0, 1)
+		}, []error{ErrChecksumMismatch}},
+		{"unknown codec", func(s []float64) { flipDescriptor(s, codecBit, 0, 1, 2) }, []error{ErrUnsupportedVersion, ErrUnknownCodec}},
+		{"codec copies disagree", func(s []float64) {
+			flipDescriptor(s, codecBit, 0, 1)
+			flipDescriptor(s, codecBit2, 2)
+		}, []error{ErrChecksumMismatch, ErrUnknownCodec}},
+	} {
+		soft := boolsToSoft(Pack(TypeText, []byte("hello")))
+		c.flips(soft)
+		_, err := DecodeFrame(soft)
+		if len(c.want) == 0 && err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		}
+		for _, want := range c.want {
+			if !errors.Is(err, want) {
+				t.Errorf("%s: got %v, want %v", c.name, err, want)
+			}
+		}
+		if errors.Is(err, ErrUnsupportedVersion) && errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("%s: %v is both unsupported and corrupted", c.name, err)
+		}
+	}
+}
+
+func TestNewCodecUnknown(t *testing.T) {
+	if _, err := NewCodec(0x09, 0); !errors.Is(err, ErrUnknownCodec) {
+		t.Errorf("got %v, want ErrUnknownCodec", err)
+	}
+}
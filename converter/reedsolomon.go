@@ -0,0 +1,368 @@
+package converter
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// GF(2^8) 运算，本原多项式 x^8 + x^4 + x^3 + x^2 + 1 (0x11d)，生成元 α = 2
+var (
+	gfExp [512]byte
+	gfLog [256]int
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfLog[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	// 扩展一倍，乘法时省去取模
+	for i := 255; i < 512; i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]+gfLog[b]]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[(gfLog[a]+255-gfLog[b])%255]
+}
+
+func gfPow(a byte, power int) byte {
+	e := (gfLog[a] * power) % 255
+	if e < 0 {
+		e += 255
+	}
+	return gfExp[e]
+}
+
+func gfInverse(a byte) byte {
+	return gfExp[255-gfLog[a]]
+}
+
+// 多项式均以高次项在前的方式存储
+
+func polyScale(p []byte, x byte) []byte {
+	r := make([]byte, len(p))
+	for i := range p {
+		r[i] = gfMul(p[i], x)
+	}
+	return r
+}
+
+func polyAdd(p, q []byte) []byte {
+	r := make([]byte, max(len(p), len(q)))
+	for i := range p {
+		r[i+len(r)-len(p)] = p[i]
+	}
+	for i := range q {
+		r[i+len(r)-len(q)] ^= q[i]
+	}
+	return r
+}
+
+func polyMul(p, q []byte) []byte {
+	r := make([]byte, len(p)+len(q)-1)
+	for j := range q {
+		for i := range p {
+			r[i+j] ^= gfMul(p[i], q[j])
+		}
+	}
+	return r
+}
+
+func polyEval(p []byte, x byte) byte {
+	y := p[0]
+	for i := 1; i < len(p); i++ {
+		y = gfMul(y, x) ^ p[i]
+	}
+	return y
+}
+
+// ReedSolomon 字节级 RS 码，每个码字最多 255 字节，其中 nsym 个校验字节
+// 每个码字最多纠正 nsym/2 个错误字节 (或 nsym 个已知位置的擦除)
+type ReedSolomon struct {
+	level     int
+	nsym      int
+	generator []byte
+}
+
+// NewReedSolomon 创建 RS 编码器，冗余等级 level (1-15) 对应每个码字 4*level 个校验字节
+func NewReedSolomon(level int) (*ReedSolomon, error) {
+	if level < 1 || level > 15 {
+		return nil, fmt.Errorf("reed-solomon level must be in [1, 15], got %d", level)
+	}
+	nsym := 4 * level
+	g := []byte{1}
+	for i := 0; i < nsym; i++ {
+		g = polyMul(g, []byte{1, gfPow(2, i)})
+	}
+	return &ReedSolomon{level: level, nsym: nsym, generator: g}, nil
+}
+
+func (rs *ReedSolomon) ID() CodecID { return CodecReedSolomon }
+
+func (rs *ReedSolomon) Level() int { return rs.level }
+
+// blockData 每个码字可容纳的数据字节数
+func (rs *ReedSolomon) blockData() int { return 255 - rs.nsym }
+
+func (rs *ReedSolomon) EncodedLen(n int) int {
+	blocks := (n + rs.blockData() - 1) / rs.blockData()
+	return (n + blocks*rs.nsym) * 8
+}
+
+func (rs *ReedSolomon) Encode(data []byte) []bool {
+	out := make([]byte, 0, rs.EncodedLen(len(data))/8)
+	for start := 0; start < len(data); start += rs.blockData() {
+		end := min(start+rs.blockData(), len(data))
+		out = append(out, rs.encodeBlock(data[start:end])...)
+	}
+	return bytesToBits(out)
+}
+
+// Decode 先按硬判决纠错；失败时把置信度最低的若干字节标记为擦除再试，
+// 擦除只占一半的纠错预算，因此能纠正更多错误
+func (rs *ReedSolomon) Decode(soft []float64, n int) ([]byte, error) {
+	soft = soft[:rs.EncodedLen(n)]
+	encoded := bitsToBytes(softToBools(soft))
+
+	// 每个字节的置信度取其 8 位中最不可信的一位
+	reliability := make([]float64, len(encoded))
+	for i := range reliability {
+		reliability[i] = math.Inf(1)
+		for _, v := range soft[i*8 : i*8+8] {
+			reliability[i] = math.Min(reliability[i], math.Abs(v))
+		}
+	}
+
+	out := make([]byte, 0, n)
+	offset := 0
+	for start := 0; start < n; start += rs.blockData() {
+		size := min(rs.blockData(), n-start) + rs.nsym
+		decoded, err := rs.decodeSoftBlock(encoded[offset:offset+size], reliability[offset:offset+size])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, decoded...)
+		offset += size
+	}
+	return out, nil
+}
+
+func (rs *ReedSolomon) decodeSoftBlock(block []byte, reliability []float64) ([]byte, error) {
+	decoded, err := rs.decodeBlock(block, nil)
+	if err == nil {
+		return decoded, nil
+	}
+
+	order := make([]int, len(block))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return reliability[order[a]] < reliability[order[b]] })
+
+	for erasures := 2; erasures <= rs.nsym; erasures += 2 {
+		decoded, err = rs.decodeBlock(block, order[:erasures])
+		if err == nil {
+			return decoded, nil
+		}
+	}
+	return nil, err
+}
+
+// encodeBlock 系统码：数据在前，校验字节在后
+func (rs *ReedSolomon) encodeBlock(msg []byte) []byte {
+	out := make([]byte, len(msg)+rs.nsym)
+	copy(out, msg)
+	for i := range msg {
+		coef := out[i]
+		if coef != 0 {
+			for j := 1; j < len(rs.generator); j++ {
+				out[i+j] ^= gfMul(rs.generator[j], coef)
+			}
+		}
+	}
+	copy(out, msg)
+	return out
+}
+
+// decodeBlock 纠正一个码字中的错误与擦除，返回数据部分
+// erasures 为已知出错的字节下标，可以为空
+func (rs *ReedSolomon) decodeBlock(block []byte, erasures []int) ([]byte, error) {
+	if len(erasures) > rs.nsym {
+		return nil, ErrUncorrectable
+	}
+	msg := make([]byte, len(block))
+	copy(msg, block)
+	for _, pos := range erasures {
+		msg[pos] = 0
+	}
+
+	synd := rs.syndromes(msg)
+	clean := true
+	for _, s := range synd {
+		if s != 0 {
+			clean = false
+			break
+		}
+	}
+	if clean {
+		return msg[:len(msg)-rs.nsym], nil
+	}
+
+	// 1. Forney 综合式消去擦除后，用 Berlekamp-Massey 求错误定位多项式
+	fsynd := forneySyndromes(synd, erasures, len(msg))
+	errLoc, err := rs.errorLocator(fsynd, len(erasures))
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Chien 搜索错误位置 (定位多项式需按低次项在前的顺序求根)
+	for i, j := 0, len(errLoc)-1; i < j; i, j = i+1, j-1 {
+		errLoc[i], errLoc[j] = errLoc[j], errLoc[i]
+	}
+	errPos, err := findErrors(errLoc, len(msg))
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. Forney 算法求错误值并修正
+	msg, err = correctErrata(msg, synd, append(append([]int{}, erasures...), errPos...))
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range rs.syndromes(msg) {
+		if s != 0 {
+			return nil, ErrUncorrectable
+		}
+	}
+	return msg[:len(msg)-rs.nsym], nil
+}
+
+// syndromes 返回 [0, S0, S1, ..., S(nsym-1)]，首位补 0 便于后续多项式运算
+func (rs *ReedSolomon) syndromes(msg []byte) []byte {
+	synd := make([]byte, rs.nsym+1)
+	for i := 0; i < rs.nsym; i++ {
+		synd[i+1] = polyEval(msg, gfPow(2, i))
+	}
+	return synd
+}
+
+func forneySyndromes(synd []byte, erasures []int, n int) []byte {
+	fsynd := make([]byte, len(synd)-1)
+	copy(fsynd, synd[1:])
+	for _, pos := range erasures {
+		x := gfPow(2, n-1-pos)
+		for j := 0; j < len(fsynd)-1; j++ {
+			fsynd[j] = gfMul(fsynd[j], x) ^ fsynd[j+1]
+		}
+	}
+	return fsynd
+}
+
+func (rs *ReedSolomon) errorLocator(synd []byte, eraseCount int) ([]byte, error) {
+	errLoc := []byte{1}
+	oldLoc := []byte{1}
+	for i := 0; i < rs.nsym-eraseCount; i++ {
+		delta := synd[i]
+		for j := 1; j < len(errLoc); j++ {
+			delta ^= gfMul(errLoc[len(errLoc)-1-j], synd[i-j])
+		}
+		oldLoc = append(oldLoc, 0)
+		if delta != 0 {
+			if len(oldLoc) > len(errLoc) {
+				newLoc := polyScale(oldLoc, delta)
+				oldLoc = polyScale(errLoc, gfInverse(delta))
+				errLoc = newLoc
+			}
+			errLoc = polyAdd(errLoc, polyScale(oldLoc, delta))
+		}
+	}
+	for len(errLoc) > 0 && errLoc[0] == 0 {
+		errLoc = errLoc[1:]
+	}
+	errs := len(errLoc) - 1
+	if errs*2+eraseCount > rs.nsym {
+		return nil, ErrUncorrectable
+	}
+	return errLoc, nil
+}
+
+func findErrors(errLoc []byte, n int) ([]int, error) {
+	errs := len(errLoc) - 1
+	var pos []int
+	for i := 0; i < n; i++ {
+		if polyEval(errLoc, gfPow(2, i)) == 0 {
+			pos = append(pos, n-1-i)
+		}
+	}
+	if len(pos) != errs {
+		return nil, ErrUncorrectable
+	}
+	return pos, nil
+}
+
+func correctErrata(msg, synd []byte, errPos []int) ([]byte, error) {
+	if len(errPos) == 0 {
+		return msg, nil
+	}
+	coefPos := make([]int, len(errPos))
+	for i, p := range errPos {
+		coefPos[i] = len(msg) - 1 - p
+	}
+
+	// 错误定位多项式
+	errLoc := []byte{1}
+	for _, p := range coefPos {
+		errLoc = polyMul(errLoc, polyAdd([]byte{1}, []byte{gfPow(2, p), 0}))
+	}
+
+	// 错误评估多项式 Ω(x) = S(x)·Λ(x) mod x^(nsym+1)
+	reversed := make([]byte, len(synd))
+	for i := range synd {
+		reversed[i] = synd[len(synd)-1-i]
+	}
+	product := polyMul(reversed, errLoc)
+	errEval := product[max(0, len(product)-len(errLoc)):]
+
+	x := make([]byte, len(coefPos))
+	for i, p := range coefPos {
+		x[i] = gfPow(2, p)
+	}
+
+	out := make([]byte, len(msg))
+	copy(out, msg)
+	for i, xi := range x {
+		xiInv := gfInverse(xi)
+
+		// Λ'(Xi^-1) 的形式导数
+		locPrime := byte(1)
+		for j, xj := range x {
+			if j != i {
+				locPrime = gfMul(locPrime, 1^gfMul(xiInv, xj))
+			}
+		}
+		if locPrime == 0 {
+			return nil, ErrUncorrectable
+		}
+
+		y := gfMul(xi, polyEval(errEval, xiInv))
+		out[errPos[i]] ^= gfDiv(y, locPrime)
+	}
+	return out, nil
+}
@@ -0,0 +1,143 @@
+package converter
+
+import (
+	"bytes"
+	"errors"
+	"math/rand/v2"
+	"testing"
+)
+
+// toSoft 把硬判决 bit 转换为 ±1 的软判决值
+func toSoft(bits []bool) []float64 {
+	soft := make([]float64, len(bits))
+	for i, b := range bits {
+		soft[i] = -1
+		if b {
+			soft[i] = 1
+		}
+	}
+	return soft
+}
+
+// corruptBytes 把 soft 中 positions 对应的字节整体取反，置信度设为 reliability
+func corruptBytes(soft []float64, positions []int, reliability float64) {
+	for _, p := range positions {
+		for i := p * 8; i < p*8+8; i++ {
+			if soft[i] >= 0 {
+				soft[i] = -reliability
+			} else {
+				soft[i] = reliability
+			}
+		}
+	}
+}
+
+func randomBytes(n int, seed uint64) []byte {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(rng.UintN(256))
+	}
+	return data
+}
+
+func TestReedSolomonLevel(t *testing.T) {
+	for _, level := range []int{0, 16, -1} {
+		if _, err := NewReedSolomon(level); err == nil {
+			t.Errorf("NewReedSolomon(%d): expected an error", level)
+		}
+	}
+}
+
+func TestReedSolomonRoundTrip(t *testing.T) {
+	// 300 字节在 level 4 (每码字 239 字节数据) 下跨两个码字，最后一个是短码字
+	for _, n := range []int{1, 16, 239, 300} {
+		rs, _ := NewReedSolomon(4)
+		data := randomBytes(n, uint64(n))
+		encoded := rs.Encode(data)
+		if len(encoded) != rs.EncodedLen(n) {
+			t.Fatalf("n=%d: encoded %d bits, EncodedLen says %d", n, len(encoded), rs.EncodedLen(n))
+		}
+		got, err := rs.Decode(toSoft(encoded), n)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("n=%d: round trip failed: %v", n, err)
+		}
+	}
+}
+
+// TestReedSolomonErrors 每个码字最多纠正 nsym/2 = 2*level 个未知位置的错误字节
+func TestReedSolomonErrors(t *testing.T) {
+	for _, level := range []int{1, 2, 4, 8} {
+		rs, _ := NewReedSolomon(level)
+		data := randomBytes(64, uint64(level))
+		encoded := rs.Encode(data)
+		size := len(encoded) / 8
+		rng := rand.New(rand.NewPCG(1, uint64(level)))
+
+		// 所有字节置信度相同，擦除重试挑不出真正出错的字节，只能靠纠错
+		soft := toSoft(encoded)
+		corruptBytes(soft, rng.Perm(size)[:2*level], 1)
+		got, err := rs.Decode(soft, len(data))
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("level %d: %d byte errors not corrected: %v", level, 2*level, err)
+		}
+
+		soft = toSoft(encoded)
+		corruptBytes(soft, rng.Perm(size)[:2*level+1], 1)
+		if got, err := rs.Decode(soft, len(data)); err == nil && bytes.Equal(got, data) {
+			t.Errorf("level %d: %d byte errors decoded, exceeds the correction limit", level, 2*level+1)
+		}
+	}
+}
+
+// TestReedSolomonErasures 已知位置的擦除只占一半纠错预算，每个码字最多恢复 nsym = 4*level 个
+func TestReedSolomonErasures(t *testing.T) {
+	for _, level := range []int{1, 2, 4, 8} {
+		rs, _ := NewReedSolomon(level)
+		data := randomBytes(64, uint64(level))
+		block := bitsToBytes(rs.Encode(data))
+		rng := rand.New(rand.NewPCG(2, uint64(level)))
+		erasures := rng.Perm(len(block))[:4*level]
+		for _, p := range erasures {
+			block[p] ^= 0xff
+		}
+		got, err := rs.decodeBlock(block, erasures)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("level %d: %d erasures not recovered: %v", level, 4*level, err)
+		}
+		if _, err := rs.decodeBlock(block, erasures[:4*level-2]); err == nil {
+			t.Errorf("level %d: decoded with 2 unmarked errors beyond the budget", level)
+		}
+	}
+}
+
+// TestReedSolomonSoftErasures 超出硬判决纠错能力 (3/4 nsym 个错误字节) 但置信度低时，
+// Decode 把最不可信的字节当作擦除重试后仍能恢复
+func TestReedSolomonSoftErasures(t *testing.T) {
+	for _, level := range []int{1, 2, 4, 8} {
+		rs, _ := NewReedSolomon(level)
+		data := randomBytes(64, uint64(level))
+		encoded := rs.Encode(data)
+		soft := toSoft(encoded)
+		rng := rand.New(rand.NewPCG(2, uint64(level)))
+		corruptBytes(soft, rng.Perm(len(encoded) / 8)[:3*level], 0.1)
+		got, err := rs.Decode(soft, len(data))
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("level %d: %d low-confidence errors not recovered: %v", level, 3*level, err)
+		}
+	}
+}
+
+func TestReedSolomonUncorrectable(t *testing.T) {
+	rs, _ := NewReedSolomon(1)
+	data := randomBytes(32, 3)
+	soft := toSoft(rs.Encode(data))
+	corruptBytes(soft, []int{0, 3, 6, 9, 12, 15, 18, 21}, 1)
+	got, err := rs.Decode(soft, len(data))
+	if err == nil && bytes.Equal(got, data) {
+		t.Fatal("8 byte errors with 4 parity bytes should not decode")
+	}
+	if err != nil && !errors.Is(err, ErrUncorrectable) {
+		t.Errorf("got %v, want ErrUncorrectable", err)
+	}
+}
@@ -0,0 +1,95 @@
+package converter
+
+import "errors"
+
+// 冗余嵌入时，打包好的 bits 被循环平铺写满整张图：
+// [Frame][Frame][Frame]...[Frame 的前半部分]
+// 提取端并不知道 Frame 的长度 (周期)，只能逐个尝试：
+// 对每个候选周期先表决出头部，若头部声明的总长度恰好等于该周期，再表决整帧并解析
+
+// probeBits 判断候选周期时只表决前 probeBits 位，足以覆盖任何编码方案下的头部
+const probeBits = preambleBits + (headerLen+60)*8
+
+// FrameLen 解析软判决值开头的头部，返回整帧 (含头部) 的 bit 数
+func FrameLen(soft []float64) (int, error) {
+	if !hasMagic(soft) {
+		_, length, err := readV1Header(soft)
+		if err != nil {
+			return 0, err
+		}
+		return v1PackedLen(length), nil
+	}
+	h, err := readHeader(soft)
+	if err != nil {
+		return 0, err
+	}
+	return h.frameLen(), nil
+}
+
+// UnpackRepeated 解析循环平铺的 bits，见 DecodeRepeatedFrame
+func UnpackRepeated(bits []bool) (WatermarkType, []byte, error) {
+	frame, err := DecodeRepeatedFrame(boolsToSoft(bits))
+	if err != nil {
+		return 0, nil, err
+	}
+	return frame.Type, frame.Data, nil
+}
+
+// DecodeRepeatedFrame 解析循环平铺的软判决值：
+// 找出帧长度后把所有副本的置信度逐位相加 (加权表决)，再解析
+// 找不到周期时 (例如只写下了一份) 退化为普通的 DecodeFrame
+// 找到了周期但内容校验失败时，返回 ErrChecksumMismatch 而不是 ErrNoWatermark
+func DecodeRepeatedFrame(soft []float64) (*Frame, error) {
+	var candidateErr error
+	for period := v1HeaderLen * 8; period*2 <= len(soft); period++ {
+		probe := VoteSoft(soft, period, min(period, probeBits))
+		if n, err := FrameLen(probe); err != nil || n != period {
+			continue
+		}
+		frame, err := DecodeFrame(VoteSoft(soft, period, period))
+		if err == nil {
+			return frame, nil
+		}
+		if candidateErr == nil && errors.Is(err, ErrChecksumMismatch) {
+			candidateErr = err
+		}
+	}
+	frame, err := DecodeFrame(soft)
+	if err != nil && candidateErr != nil {
+		return nil, candidateErr
+	}
+	return frame, err
+}
+
+// Vote 把 bits 按 period 切成若干副本，对每个副本的前 n 位逐位多数表决
+// 票数相同时以第一份副本为准
+func Vote(bits []bool, period, n int) []bool {
+	out := make([]bool, n)
+	for j := 0; j < n; j++ {
+		ones, total := 0, 0
+		for i := j; i < len(bits); i += period {
+			total++
+			if bits[i] {
+				ones++
+			}
+		}
+		switch {
+		case ones*2 > total:
+			out[j] = true
+		case ones*2 == total:
+			out[j] = bits[j]
+		}
+	}
+	return out
+}
+
+// VoteSoft 同 Vote，但把各副本的软判决值相加，置信度高的副本权重更大
+func VoteSoft(soft []float64, period, n int) []float64 {
+	out := make([]float64, n)
+	for j := 0; j < n; j++ {
+		for i := j; i < len(soft); i += period {
+			out[j] += soft[i]
+		}
+	}
+	return out
+}
@@ -0,0 +1,88 @@
+package converter
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// tile 把 frame 循环平铺到 n 位，模拟冗余嵌入
+func tile(frame []bool, n int) []bool {
+	out := make([]bool, n)
+	for i := range out {
+		out[i] = frame[i%len(frame)]
+	}
+	return out
+}
+
+func TestVote(t *testing.T) {
+	bits := []bool{
+		true, false, true,
+		true, true, false,
+		false, false, true,
+		true, false,
+	}
+	// 第 3 列只有 3 份副本，1 对 2，按多数为 true；第 1、2 列各 4 份
+	got := Vote(bits, 3, 3)
+	want := []bool{true, false, true}
+	if !slices.Equal(got, want) {
+		t.Errorf("Vote = %v, want %v", got, want)
+	}
+	// 2 对 2 时以第一份副本为准
+	if got := Vote([]bool{false, true, true, false}, 1, 1); got[0] {
+		t.Error("tie should follow the first copy")
+	}
+}
+
+func TestVoteSoft(t *testing.T) {
+	// 置信度高的一份副本压过两份置信度低的
+	got := VoteSoft([]float64{5, -1, -1}, 1, 1)
+	if got[0] != 3 {
+		t.Errorf("VoteSoft = %v, want [3]", got)
+	}
+}
+
+func TestDecodeRepeatedFrame(t *testing.T) {
+	data := []byte("user-42")
+	for _, codec := range []Codec{nil, NewConvolutional()} {
+		frame := PackWithCodec(TypeText, data, codec)
+		soft := boolsToSoft(tile(frame, 12*len(frame)+len(frame)/3))
+
+		// 每一位叠加标准差为 1 的高斯噪声 (误码率约 16%)，单份无法解析，12 份相加后可以
+		rng := rand.New(rand.NewPCG(1, 1))
+		for i := range soft {
+			soft[i] += rng.NormFloat64()
+		}
+		if _, err := DecodeFrame(soft); err == nil {
+			t.Fatal("a single noisy copy should not decode")
+		}
+		got, err := DecodeRepeatedFrame(soft)
+		if err != nil {
+			t.Fatalf("codec %v: %v", codec, err)
+		}
+		if got.Type != TypeText || !bytes.Equal(got.Data, data) {
+			t.Errorf("codec %v: got %v %q", codec, got.Type, got.Data)
+		}
+	}
+}
+
+// TestDecodeRepeatedFrameSingleCopy 只写下一份时找不到周期，退化为普通解析
+func TestDecodeRepeatedFrameSingleCopy(t *testing.T) {
+	frame := Pack(TypeText, []byte("hello"))
+	soft := boolsToSoft(append(frame, make([]bool, len(frame)/2)...))
+	got, err := DecodeRepeatedFrame(soft)
+	if err != nil || string(got.Data) != "hello" {
+		t.Fatalf("got %v, %v", got, err)
+	}
+}
+
+func TestFrameLen(t *testing.T) {
+	for _, codec := range []Codec{nil, NewConvolutional()} {
+		frame := PackWithCodec(TypeText, []byte("hello"), codec)
+		n, err := FrameLen(boolsToSoft(frame))
+		if err != nil || n != len(frame) {
+			t.Errorf("codec %v: FrameLen = %d, %v, want %d", codec, n, err, len(frame))
+		}
+	}
+}
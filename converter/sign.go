@@ -0,0 +1,55 @@
+package converter
+
+import (
+	"crypto/ed25519"
+	"errors"
+)
+
+// FlagSigned 类型字节的次高位，表示载荷末尾附带 Ed25519 签名
+// 签名后的载荷结构: [Data] + [Signature(64 bytes)]
+// 同时加密时先加密再签名，Data 为加密后的密文，第三方无需密钥即可验证来源
+const FlagSigned WatermarkType = 0x40
+
+// SignatureOverhead 签名带来的额外字节数
+const SignatureOverhead = ed25519.SignatureSize
+
+// signContext 签名内容的前缀，避免同一把私钥的签名被挪作他用
+const signContext = "blindwatermark/sign:"
+
+// ErrSignatureMissing 载荷被标记为已签名，但长度不足以容纳签名
+var ErrSignatureMissing = errors.New("watermark signature missing")
+
+// Signed 是否附带签名
+func (t WatermarkType) Signed() bool {
+	return t&FlagSigned != 0
+}
+
+// Sign 用私钥对类型字节和 data 签名，返回附带签名的载荷
+func Sign(privateKey ed25519.PrivateKey, wmType WatermarkType, data []byte) []byte {
+	sig := ed25519.Sign(privateKey, signedMessage(wmType, data))
+	return append(append(make([]byte, 0, len(data)+len(sig)), data...), sig...)
+}
+
+// SplitSignature 把附带签名的载荷拆分为数据和签名
+func SplitSignature(signed []byte) (data, sig []byte, err error) {
+	if len(signed) < SignatureOverhead {
+		return nil, nil, ErrSignatureMissing
+	}
+	n := len(signed) - SignatureOverhead
+	return signed[:n], signed[n:], nil
+}
+
+// Verify 用公钥校验 Sign 生成的签名
+func Verify(publicKey ed25519.PublicKey, wmType WatermarkType, data, sig []byte) bool {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return false
+	}
+	return ed25519.Verify(publicKey, signedMessage(wmType, data), sig)
+}
+
+func signedMessage(wmType WatermarkType, data []byte) []byte {
+	msg := make([]byte, 0, len(signContext)+1+len(data))
+	msg = append(msg, signContext...)
+	msg = append(msg, byte(wmType))
+	return append(msg, data...)
+}
@@ -0,0 +1,48 @@
+package converter
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+)
+
+func TestSignVerify(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	otherPub, _, _ := ed25519.GenerateKey(nil)
+	payload := Sign(priv, TypeText|FlagSigned, []byte("hello"))
+	if len(payload) != len("hello")+SignatureOverhead {
+		t.Fatalf("signed payload is %d bytes", len(payload))
+	}
+	data, sig, err := SplitSignature(payload)
+	if err != nil || !bytes.Equal(data, []byte("hello")) {
+		t.Fatalf("SplitSignature = %q, %v", data, err)
+	}
+	if !Verify(pub, TypeText|FlagSigned, data, sig) {
+		t.Error("valid signature rejected")
+	}
+
+	tampered := bytes.Clone(data)
+	tampered[0] ^= 1
+	for _, c := range []struct {
+		name   string
+		pub    ed25519.PublicKey
+		wmType WatermarkType
+		data   []byte
+	}{
+		{"other key", otherPub, TypeText | FlagSigned, data},
+		{"tampered data", pub, TypeText | FlagSigned, tampered},
+		{"type swapped", pub, TypeQRCode | FlagSigned, data},
+		{"short key", pub[:16], TypeText | FlagSigned, data},
+	} {
+		if Verify(c.pub, c.wmType, c.data, sig) {
+			t.Errorf("%s: signature accepted", c.name)
+		}
+	}
+}
+
+func TestSplitSignatureShort(t *testing.T) {
+	if _, _, err := SplitSignature(make([]byte, SignatureOverhead-1)); !errors.Is(err, ErrSignatureMissing) {
+		t.Errorf("got %v, want ErrSignatureMissing", err)
+	}
+}
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"blindwatermark/internal/testimage"
+	"fmt"
+	"image"
+	"testing"
+)
+
+// TestBlockSize 容量与分块面积成反比，不支持的边长按 8 处理
+func TestBlockSize(t *testing.T) {
+	eight := (&Engine{}).Capacity(512, 384)
+	for _, c := range []struct {
+		size, want int
+	}{{0, 8}, {4, 4}, {8, 8}, {16, 16}, {5, 8}, {32, 8}} {
+		e := &Engine{BlockSize: c.size}
+		if got := e.blockSize(); got != c.want {
+			t.Errorf("BlockSize %d: block size %d, want %d", c.size, got, c.want)
+		}
+		if got, want := e.Capacity(512, 384), eight*64/(c.want*c.want); got != want {
+			t.Errorf("BlockSize %d: capacity %d, want %d", c.size, got, want)
+		}
+	}
+}
+
+// TestBlockSizeEmbed 各分块边长下各种调制方式和分块模式都能无误提取
+func TestBlockSizeEmbed(t *testing.T) {
+	src := testimage.Photo(t, 512, 384)
+	for _, size := range []int{4, 16} {
+		for _, base := range []Engine{
+			{Strength: 20, Refine: 2},
+			{Strength: 20, Key: []byte("k"), BitsPerBlock: 2, Adaptive: true},
+			{Modulation: ModulationSTDM, Levels: 2},
+			{Strength: 20, TileSize: 256},
+		} {
+			e := base
+			e.BlockSize = size
+			bits := randomBits(e.Capacity(512, 384), 19)
+			if ber := bitErrorRate(e.ExtractSoft(e.Embed(src, bits)), bits); ber != 0 {
+				t.Errorf("BlockSize %d, %+v: BER %.4f", size, base, ber)
+			}
+		}
+	}
+}
+
+// BenchmarkBlockSize README 中分块大小一节的表格：1531x1014 的示例照片，只用 HL、1 级分解、校验 2 轮，容量写满
+func BenchmarkBlockSize(b *testing.B) {
+	src := testimage.Photo(b, 1531, 1014)
+	for _, c := range []struct{ size, strength int }{{4, 20}, {8, 20}, {16, 20}, {16, 40}} {
+		b.Run(fmt.Sprintf("%dx%d/strength=%d", c.size, c.size, c.strength), func(b *testing.B) {
+			e := &Engine{Strength: float64(c.strength), Refine: 2, BlockSize: c.size}
+			bits := randomBits(e.Capacity(1531, 1014), 20)
+			var out image.Image
+			for b.Loop() {
+				out = e.Embed(src, bits)
+			}
+			b.ReportMetric(float64(len(bits)), "bits")
+			b.ReportMetric(psnr(src, out), "PSNR-dB")
+			b.ReportMetric(bitErrorRate(e.ExtractSoft(testimage.JPEGRoundTrip(b, out, 90)), bits)*100, "q90-BER-%")
+			b.ReportMetric(bitErrorRate(e.ExtractSoft(testimage.JPEGRoundTrip(b, out, 75)), bits)*100, "q75-BER-%")
+		})
+	}
+}
+
+// TestMinSize 宽高为 MinSize 时每个子带恰好放下一个块，再小一个像素容量就为 0；超过 MaxLevels 的级数按 MaxLevels 处理
+func TestMinSize(t *testing.T) {
+	for _, e := range []*Engine{{}, {Levels: 3}, {BlockSize: 4, Levels: 2}, {BlockSize: 16}, {Levels: 64}} {
+		s := e.MinSize()
+		if e.Capacity(s, s) != 1 || e.Capacity(s-1, s) != 0 || e.Capacity(s, s-1) != 0 {
+			t.Errorf("levels %d, block size %d: capacity %d at %dx%d", e.Levels, e.BlockSize, e.Capacity(s, s), s, s)
+		}
+	}
+	if s := (&Engine{Levels: 64}).MinSize(); s != N<<MaxLevels {
+		t.Errorf("levels 64: min size %d, want %d", s, N<<MaxLevels)
+	}
+}
+
+func TestDefaultPairs(t *testing.T) {
+	for _, n := range []int{4, 8, 16} {
+		pairs := DefaultPairs(n)
+		if len(pairs) != 5 {
+			t.Errorf("block size %d: %d default pairs", n, len(pairs))
+		}
+		pairs[0][0][0] = -1
+		if (&Engine{BlockSize: n}).pairs()[0][0][0] == -1 {
+			t.Errorf("block size %d: DefaultPairs shares the engine's table", n)
+		}
+	}
+	if DefaultPairs(5) != nil || DefaultPairs(MaxBlockSize*2) != nil {
+		t.Error("default pairs for an unsupported block size")
+	}
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// 色度通道：
+// 默认只有 Y 承载数据。Engine.Chroma 可以再加上 Cb、Cr，每个色度通道使用与 Y 完全相同的
+// DWT 级数、子带和落点布局 (包括密钥打乱的顺序)，容量随之翻倍或三倍。
+// bits 依次写入 Y、Cb、Cr 的各个落点：第 n 个通道的第 k 个落点写第 n * 单通道容量 + k 位，
+// 冗余模式下同样按这个顺序循环。同步模板只加在 Y 上。
+// 灰度图片 (颜色模型为 Gray / Gray16) 的输出也是灰度，没有地方存放色度，此时忽略 Chroma，只用 Y，
+// 容量见 ImageCapacity；提取时按同一规则判断，灰度的嵌入结果始终只读 Y。
+// 色度通道使用较低的强度 (ChromaStrength，默认 Strength 的一半)：JPEG 等有损格式通常对色度做 2x2 下采样，
+// 最细一级的色度细节会被直接抹掉，色度里的数据只适合无损格式 (PNG、4:4:4 的 YCbCr 等)，不必用与 Y 一样的强度
+
+// Channel 除 Y 之外额外承载数据的色度通道，可以按位组合
+type Channel int
+
+const (
+	ChannelCb Channel = 1 << iota // 蓝色色度
+	ChannelCr                     // 红色色度
+)
+
+// channelY 亮度通道，始终使用
+const channelY Channel = 0
+
+// channels 图片 img 中承载数据的通道，按写入顺序排列；img 为 nil 时按彩色图片处理
+func (e *Engine) channels(img image.Image) []Channel {
+	chs := []Channel{channelY}
+	if img != nil && isGray(img) {
+		return chs
+	}
+	for _, ch := range []Channel{ChannelCb, ChannelCr} {
+		if e.Chroma&ch != 0 {
+			chs = append(chs, ch)
+		}
+	}
+	return chs
+}
+
+// isGray img 是否为灰度图片，按颜色模型判断，流式输出等包装过的图片同样适用
+func isGray(img image.Image) bool {
+	model := img.ColorModel()
+	return model == color.GrayModel || model == color.Gray16Model
+}
+
+// strength 通道 ch 的嵌入强度，QIM / STDM 模式下为量化步长
+func (e *Engine) strength(ch Channel) float64 {
+	s := e.Strength
+	if e.Modulation != ModulationPair {
+		s = e.step()
+	}
+	if ch == channelY {
+		return s
+	}
+	if e.ChromaStrength > 0 {
+		return e.ChromaStrength
+	}
+	return s / 2
+}
+
+// planeMatrix 读取以 (x0, y0) 为左上角、w x h 区域的通道 ch，按行并行
+// YCbCr 图片直接读对应的平面 (色度按最近的采样点)
+func (e *Engine) planeMatrix(img image.Image, ch Channel, x0, y0, w, h int) *Matrix {
+	m := NewMatrix(h, w)
+	e.readPlane(m, img, ch, x0, y0)
+	return m
+}
+
+// readPlane 同 planeMatrix，读入已有的矩阵 m，区域大小为 m 的大小
+func (e *Engine) readPlane(m *Matrix, img image.Image, ch Channel, x0, y0 int) {
+	if ch == channelY {
+		e.readLuma(m, img, x0, y0)
+		return
+	}
+	ycc, _ := img.(*image.YCbCr)
+	var plane []uint8
+	if ycc != nil {
+		plane = ycc.Cb
+		if ch == ChannelCr {
+			plane = ycc.Cr
+		}
+	}
+	read := pixelReader(img)
+	parallelFor(e.workers(), m.Rows, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			row := m.Row(i)
+			for j := range row {
+				if plane != nil {
+					row[j] = float64(plane[ycc.COffset(x0+j, y0+i)])
+					continue
+				}
+				cb, cr := chroma(read(x0+j, y0+i))
+				if row[j] = cb; ch == ChannelCr {
+					row[j] = cr
+				}
+			}
+		}
+	})
+}
+
+// chroma 像素的 Cb、Cr (JPEG 使用的 BT.601 全范围公式)，按非预乘的颜色计算
+func chroma(r, g, b float64, _ uint32) (cb, cr float64) {
+	return rgbToChroma(r, g, b)
+}
+
+func rgbToChroma(r, g, b float64) (cb, cr float64) {
+	return -0.168736*r - 0.331264*g + 0.5*b + 128, 0.5*r - 0.418688*g - 0.081312*b + 128
+}
+
+// shiftChroma 把颜色 (r, g, b) 的 Cb、Cr 分别增加 dcb、dcr，Y 不变
+// 结果可能超出 [0, 255]，由调用方截断
+func shiftChroma(r, g, b, dcb, dcr float64) (float64, float64, float64) {
+	return r + 1.402*dcr, g - 0.344136*dcb - 0.714136*dcr, b + 1.772*dcb
+}
+
+// keep 合成时表示该通道保持不变
+var keep = math.NaN()
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"blindwatermark/internal/testimage"
+	"fmt"
+	"image"
+	"testing"
+)
+
+// TestChromaCapacity 每个色度通道增加一份与 Y 相同的容量
+func TestChromaCapacity(t *testing.T) {
+	y := (&Engine{}).Capacity(512, 384)
+	for _, c := range []struct {
+		chroma Channel
+		want   int
+	}{{0, y}, {ChannelCb, 2 * y}, {ChannelCr, 2 * y}, {ChannelCb | ChannelCr, 3 * y}} {
+		if got := (&Engine{Chroma: c.chroma}).Capacity(512, 384); got != c.want {
+			t.Errorf("Chroma %d: capacity %d, want %d", c.chroma, got, c.want)
+		}
+	}
+}
+
+// TestChromaGray 灰度图片不计色度通道：容量只有 Y 的一份，嵌入和提取都只用 Y
+func TestChromaGray(t *testing.T) {
+	e := &Engine{Strength: 20, Chroma: ChannelCb | ChannelCr, Refine: 2}
+	y := (&Engine{}).Capacity(512, 384)
+	photo := testimage.Photo(t, 512, 384)
+	for _, src := range []image.Image{convert(image.NewGray(photo.Rect), photo), convert(image.NewGray16(photo.Rect), photo)} {
+		if got := e.ImageCapacity(src); got != y {
+			t.Fatalf("%T: capacity %d, want %d", src, got, y)
+		}
+		bits := randomBits(y, 21)
+		out := e.Embed(src, bits)
+		soft := e.ExtractSoft(out)
+		if len(soft) != y {
+			t.Fatalf("%T: extracted %d values, want %d", src, len(soft), y)
+		}
+		if ber := bitErrorRate(soft, bits); ber != 0 {
+			t.Errorf("%T: BER %.4f", src, ber)
+		}
+	}
+}
+
+func TestChromaStrength(t *testing.T) {
+	e := &Engine{Strength: 20}
+	if e.strength(channelY) != 20 || e.strength(ChannelCb) != 10 {
+		t.Errorf("strength Y %v, Cb %v; want 20 and the default half", e.strength(channelY), e.strength(ChannelCb))
+	}
+	e.ChromaStrength = 7
+	if e.strength(ChannelCr) != 7 {
+		t.Errorf("strength Cr %v with ChromaStrength 7", e.strength(ChannelCr))
+	}
+}
+
+// TestChromaEmbed RGB 和 YCbCr 输入在三个通道中都能无误提取；YCbCr 输入输出 4:4:4
+func TestChromaEmbed(t *testing.T) {
+	photo := testimage.Photo(t, 512, 384)
+	ycc := testimage.JPEGRoundTrip(t, photo, 100).(*image.YCbCr)
+	for _, src := range []image.Image{photo, ycc} {
+		for _, chroma := range []Channel{ChannelCb, ChannelCr, ChannelCb | ChannelCr} {
+			e := &Engine{Strength: 20, Chroma: chroma, Refine: 2}
+			bits := randomBits(e.Capacity(512, 384), 10)
+			out := e.Embed(src, bits)
+			if o, ok := out.(*image.YCbCr); ok && o.SubsampleRatio != image.YCbCrSubsampleRatio444 {
+				t.Errorf("%T, Chroma %d: output subsampling %v, want 4:4:4", src, chroma, o.SubsampleRatio)
+			}
+			if ber := bitErrorRate(e.ExtractSoft(out), bits); ber != 0 {
+				t.Errorf("%T, Chroma %d: BER %.4f", src, chroma, ber)
+			}
+		}
+	}
+}
+
+// TestChromaJPEG 色度通道的数据经 4:2:0 的 JPEG 后丢失，Y 中的数据不受影响
+func TestChromaJPEG(t *testing.T) {
+	e := &Engine{Strength: 20, Chroma: ChannelCb | ChannelCr, Refine: 2}
+	bits := randomBits(e.Capacity(512, 384), 11)
+	soft := e.ExtractSoft(testimage.JPEGRoundTrip(t, e.Embed(testimage.Photo(t, 512, 384), bits), 90))
+	n := len(bits) / 3
+	if ber := bitErrorRate(soft[:n], bits[:n]); ber > 0.03 {
+		t.Errorf("Y BER %.4f after JPEG q90", ber)
+	}
+	if ber := bitErrorRate(soft[n:], bits[n:]); ber < 0.2 {
+		t.Errorf("chroma BER %.4f after JPEG q90, expected the data to be lost", ber)
+	}
+}
+
+// BenchmarkChromaPSNR README 中色度通道一节的 PSNR：512x512 的示例照片，强度 20
+func BenchmarkChromaPSNR(b *testing.B) {
+	src := testimage.Photo(b, 512, 512)
+	for _, chroma := range []Channel{0, ChannelCb | ChannelCr} {
+		b.Run(fmt.Sprintf("chroma=%d", chroma), func(b *testing.B) {
+			e := &Engine{Strength: 20, Refine: 2, Chroma: chroma}
+			bits := randomBits(e.Capacity(512, 512), 12)
+			var p float64
+			for b.Loop() {
+				p = psnr(src, e.Embed(src, bits))
+			}
+			b.ReportMetric(p, "PSNR-dB")
+		})
+	}
+}
@@ -4,10 +4,11 @@ import (
 	"math"
 )
 
-const N = 8 // 块大小 8x8
+const N = 8 // 默认的分块大小 8x8 (Engine.BlockSize 为 0 时)
 
 // SimpleDCT 简单的二维离散余弦变换
 // 输入 8x8 空间域矩阵，输出 8x8 频域矩阵
+// 直接按定义计算，速度很慢，仅作为 FastDCT 的参考实现保留
 func SimpleDCT(block [][]float64) [][]float64 {
 	result := make([][]float64, N)
 	for i := range result {
@@ -59,3 +60,80 @@ func c(k int) float64 {
 	}
 	return 1.0
 }
+
+// MaxBlockSize 支持的最大 DCT 分块边长 (Engine.BlockSize)，块缓冲区按它分配在栈上
+const MaxBlockSize = 16
+
+// dctTables 各分块边长的一维正交 DCT 变换矩阵 (按行存储)：dctTables[n][u*n+x] = c(u) * sqrt(2/n) * cos((2x+1)uπ / 2n)
+// 二维 DCT 可分离为先对每行、再对每列做一维 DCT，n = 8 时结果与 SimpleDCT 一致
+var dctTables = func() (tables [MaxBlockSize + 1][]float64) {
+	for _, n := range []int{4, 8, 16} {
+		t := make([]float64, n*n)
+		for u := 0; u < n; u++ {
+			for x := 0; x < n; x++ {
+				t[u*n+x] = c(u) * math.Sqrt(2/float64(n)) * math.Cos((2*float64(x)+1)*float64(u)*math.Pi/float64(2*n))
+			}
+		}
+		tables[n] = t
+	}
+	return tables
+}()
+
+// FastDCT 原地对按行存储的 n x n 块 (block[i*n+j]) 做二维 DCT，n 为 4、8 或 16
+// 查表 + 行列分离，8x8 时每块 1024 次乘法且不分配内存；SimpleDCT 保留作对照
+func FastDCT(block []float64, n int) {
+	t := dctTables[n]
+	var buf [MaxBlockSize * MaxBlockSize]float64
+	tmp := buf[:n*n]
+	// 1. 行变换: tmp[i][v] = Σ_y block[i][y] * T[v][y]
+	for i := 0; i < n; i++ {
+		row := block[i*n : i*n+n]
+		for v := 0; v < n; v++ {
+			tv := t[v*n : v*n+n]
+			var sum float64
+			for y, x := range row {
+				sum += x * tv[y]
+			}
+			tmp[i*n+v] = sum
+		}
+	}
+	// 2. 列变换: block[u][v] = Σ_x T[u][x] * tmp[x][v]
+	for u := 0; u < n; u++ {
+		tu := t[u*n : u*n+n]
+		for v := 0; v < n; v++ {
+			var sum float64
+			for x, tx := range tu {
+				sum += tx * tmp[x*n+v]
+			}
+			block[u*n+v] = sum
+		}
+	}
+}
+
+// FastIDCT FastDCT 的逆变换 (变换矩阵正交，逆即转置)
+func FastIDCT(block []float64, n int) {
+	t := dctTables[n]
+	var buf [MaxBlockSize * MaxBlockSize]float64
+	tmp := buf[:n*n]
+	// 1. 列逆变换: tmp[x][v] = Σ_u T[u][x] * block[u][v]
+	for x := 0; x < n; x++ {
+		for v := 0; v < n; v++ {
+			var sum float64
+			for u := 0; u < n; u++ {
+				sum += t[u*n+x] * block[u*n+v]
+			}
+			tmp[x*n+v] = sum
+		}
+	}
+	// 2. 行逆变换: block[x][y] = Σ_v tmp[x][v] * T[v][y]
+	for x := 0; x < n; x++ {
+		row := tmp[x*n : x*n+n]
+		for y := 0; y < n; y++ {
+			var sum float64
+			for v, r := range row {
+				sum += r * t[v*n+y]
+			}
+			block[x*n+y] = sum
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+func randomBlock(n int, seed uint64) []float64 {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	block := make([]float64, n*n)
+	for i := range block {
+		block[i] = rng.Float64()*255 - 128
+	}
+	return block
+}
+
+// TestFastDCTMatchesSimpleDCT 8x8 时可分离实现与按定义计算的 SimpleDCT 一致
+func TestFastDCTMatchesSimpleDCT(t *testing.T) {
+	for seed := range uint64(10) {
+		block := randomBlock(N, seed)
+		rows := make([][]float64, N)
+		for i := range rows {
+			rows[i] = append([]float64(nil), block[i*N:(i+1)*N]...)
+		}
+		want := SimpleDCT(rows)
+		FastDCT(block, N)
+		for u := 0; u < N; u++ {
+			for v := 0; v < N; v++ {
+				if math.Abs(block[u*N+v]-want[u][v]) > 1e-9 {
+					t.Fatalf("seed %d: coefficient [%d][%d] is %.12f, SimpleDCT gives %.12f", seed, u, v, block[u*N+v], want[u][v])
+				}
+			}
+		}
+
+		back := SimpleIDCT(want)
+		FastIDCT(block, N)
+		for i := range block {
+			if math.Abs(block[i]-back[i/N][i%N]) > 1e-9 {
+				t.Fatalf("seed %d: FastIDCT sample %d is %.12f, SimpleIDCT gives %.12f", seed, i, block[i], back[i/N][i%N])
+			}
+		}
+	}
+}
+
+func TestDCTRoundTrip(t *testing.T) {
+	for _, n := range []int{4, 8, 16} {
+		src := randomBlock(n, uint64(n))
+		block := append([]float64(nil), src...)
+		FastDCT(block, n)
+		FastIDCT(block, n)
+		for i := range src {
+			if math.Abs(block[i]-src[i]) > 1e-9 {
+				t.Fatalf("n=%d: sample %d is %.12f, want %.12f", n, i, block[i], src[i])
+			}
+		}
+	}
+}
+
+// TestDCTOrthonormal 正交变换保持能量，常数块只有直流分量
+func TestDCTOrthonormal(t *testing.T) {
+	for _, n := range []int{4, 8, 16} {
+		block := randomBlock(n, 1)
+		energy := 0.0
+		for _, v := range block {
+			energy += v * v
+		}
+		FastDCT(block, n)
+		for _, v := range block {
+			energy -= v * v
+		}
+		if math.Abs(energy) > 1e-6 {
+			t.Errorf("n=%d: energy changed by %g", n, energy)
+		}
+
+		flat := make([]float64, n*n)
+		for i := range flat {
+			flat[i] = 10
+		}
+		FastDCT(flat, n)
+		if math.Abs(flat[0]-10*float64(n)) > 1e-9 {
+			t.Errorf("n=%d: DC of a flat block is %.6f, want %d", n, flat[0], 10*n)
+		}
+		for i, v := range flat[1:] {
+			if math.Abs(v) > 1e-9 {
+				t.Errorf("n=%d: AC coefficient %d of a flat block is %g", n, i+1, v)
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkSimpleDCT(b *testing.B) {
+	block := randomBlock(N, 1)
+	rows := make([][]float64, N)
+	for i := range rows {
+		rows[i] = block[i*N : (i+1)*N]
+	}
+	for b.Loop() {
+		SimpleDCT(rows)
+	}
+}
+
+func BenchmarkFastDCT(b *testing.B) {
+	for _, n := range []int{4, 8, 16} {
+		b.Run(fmt.Sprintf("%dx%d", n, n), func(b *testing.B) {
+			block := randomBlock(n, 1)
+			for b.Loop() {
+				FastDCT(block, n)
+			}
+		})
+	}
+}
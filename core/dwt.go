@@ -14,84 +14,123 @@ const Sqrt2 = 1.41421356237
 // 左下: LH (垂直细节 - 适合嵌入)
 // 右下: HH (对角细节 - 噪点多，不适合)
 func DWT2D(matrix [][]float64) [][]float64 {
-	h := len(matrix)
-	w := len(matrix[0])
+	m := MatrixFromRows(matrix)
+	dwt2D(m, Haar, 1)
+	return m.Slices()
+}
 
+// dwt2D 用小波 wl 对 m 原地做一次二维变换，象限布局同 DWT2D
+// 各行 (各列) 的变换互不依赖，按 workers 并行；每个 worker 只分配一行 (一列) 大小的缓冲
+func dwt2D(m *Matrix, wl Wavelet, workers int) {
 	// 1. 行变换 (Row Transform)
-	temp := make([][]float64, h)
-	for i := 0; i < h; i++ {
-		temp[i] = dwt1D(matrix[i])
-	}
-
-	// 2. 列变换 (Col Transform)
-	// 需要先转置或者按列读，这里为了简单，分配结果矩阵直接填入
-	output := make([][]float64, h)
-	for i := range output {
-		output[i] = make([]float64, w)
-	}
-
-	//halfH := h / 2
-	for j := 0; j < w; j++ {
-		// 提取这一列
-		col := make([]float64, h)
-		for i := 0; i < h; i++ {
-			col[i] = temp[i][j]
+	parallelFor(workers, m.Rows, func(lo, hi int) {
+		buf := make([]float64, m.Cols)
+		for i := lo; i < hi; i++ {
+			row := m.Row(i)
+			copy(buf, row)
+			wl.Forward(row, buf)
 		}
-		// 做 1D 变换
-		transCol := dwt1D(col)
-		// 填回 output
-		for i := 0; i < h; i++ {
-			output[i][j] = transCol[i]
+	})
+
+	// 2. 列变换 (Col Transform)，按列读出、变换后写回
+	parallelFor(workers, m.Cols, func(lo, hi int) {
+		col := make([]float64, m.Rows)
+		buf := make([]float64, m.Rows)
+		for j := lo; j < hi; j++ {
+			m.column(j, col)
+			wl.Forward(buf, col)
+			m.setColumn(j, buf)
 		}
-	}
+	})
 
-	// 此时 output 的四个象限已经是 LL, HL, LH, HH
+	// 此时 m 的四个象限已经是 LL, HL, LH, HH
 	// 行的上半部分是 L，下半部分是 H (因为 dwt1D 把 L 放前，H 放后)
 	// 但通常图像处理习惯将 LL 放在左上角。
 	// 我们的 dwt1D 逻辑是: [L..., H...]，所以经过行列变换后：
 	// 行(L, H) -> 列(L, H) -> 结果自然就是:
 	// LL HL
 	// LH HH
-	return output
+}
+
+// DWT2DLevels 用小波 wl (nil 表示 Haar) 对矩阵做 levels 级二维分解，每一级只对上一级的 LL (左上角) 继续分解
+// 宽高必须能被 2^levels 整除。第 l 级的 HL 位于行 [0, h>>l)、列 [w>>l, w>>(l-1))，其余子带类推
+func DWT2DLevels(matrix [][]float64, levels int, wl Wavelet) [][]float64 {
+	m := MatrixFromRows(matrix)
+	DWT2DInPlace(m, levels, wl)
+	return m.Slices()
+}
+
+// DWT2DInPlace 同 DWT2DLevels，但直接在 m 上变换，不复制矩阵
+func DWT2DInPlace(m *Matrix, levels int, wl Wavelet) {
+	dwt2DLevels(m, levels, wl, 1)
+}
+
+func dwt2DLevels(m *Matrix, levels int, wl Wavelet, workers int) {
+	if wl == nil {
+		wl = Haar
+	}
+	for l := 0; l < max(levels, 1); l++ {
+		dwt2D(m.View(0, 0, m.Rows>>l, m.Cols>>l), wl, workers)
+	}
+}
+
+// IDWT2DLevels DWT2DLevels 的逆变换，从最深一级开始逐级重建
+func IDWT2DLevels(matrix [][]float64, levels int, wl Wavelet) [][]float64 {
+	m := MatrixFromRows(matrix)
+	IDWT2DInPlace(m, levels, wl)
+	return m.Slices()
+}
+
+// IDWT2DInPlace 同 IDWT2DLevels，但直接在 m 上变换，不复制矩阵
+func IDWT2DInPlace(m *Matrix, levels int, wl Wavelet) {
+	idwt2DLevels(m, levels, wl, 1)
+}
+
+func idwt2DLevels(m *Matrix, levels int, wl Wavelet, workers int) {
+	if wl == nil {
+		wl = Haar
+	}
+	for l := max(levels, 1) - 1; l >= 0; l-- {
+		idwt2D(m.View(0, 0, m.Rows>>l, m.Cols>>l), wl, workers)
+	}
 }
 
 // IDWT2D 二维离散小波逆变换
 func IDWT2D(matrix [][]float64) [][]float64 {
-	h := len(matrix)
-	w := len(matrix[0])
+	m := MatrixFromRows(matrix)
+	idwt2D(m, Haar, 1)
+	return m.Slices()
+}
 
+// idwt2D dwt2D 的逆变换，原地进行
+func idwt2D(m *Matrix, wl Wavelet, workers int) {
 	// 1. 列逆变换
-	temp := make([][]float64, h)
-	for i := range temp {
-		temp[i] = make([]float64, w)
-	}
-
-	for j := 0; j < w; j++ {
-		col := make([]float64, h)
-		for i := 0; i < h; i++ {
-			col[i] = matrix[i][j]
+	parallelFor(workers, m.Cols, func(lo, hi int) {
+		col := make([]float64, m.Rows)
+		buf := make([]float64, m.Rows)
+		for j := lo; j < hi; j++ {
+			m.column(j, col)
+			wl.Inverse(buf, col)
+			m.setColumn(j, buf)
 		}
-		origCol := idwt1D(col)
-		for i := 0; i < h; i++ {
-			temp[i][j] = origCol[i]
-		}
-	}
+	})
 
 	// 2. 行逆变换
-	output := make([][]float64, h)
-	for i := 0; i < h; i++ {
-		output[i] = idwt1D(temp[i])
-	}
-
-	return output
+	parallelFor(workers, m.Rows, func(lo, hi int) {
+		buf := make([]float64, m.Cols)
+		for i := lo; i < hi; i++ {
+			row := m.Row(i)
+			copy(buf, row)
+			wl.Inverse(row, buf)
+		}
+	})
 }
 
-// dwt1D 一维 Haar 变换
+// dwt1D 一维 Haar 变换，结果写入 output
 // 输入长度必须是偶数
-func dwt1D(data []float64) []float64 {
+func dwt1D(output, data []float64) {
 	n := len(data)
 	half := n / 2
-	output := make([]float64, n)
 
 	for i := 0; i < half; i++ {
 		// Haar 公式:
@@ -100,14 +139,12 @@ func dwt1D(data []float64) []float64 {
 		output[i] = (data[2*i] + data[2*i+1]) / Sqrt2      // Low freq 部分放在前半段
 		output[half+i] = (data[2*i] - data[2*i+1]) / Sqrt2 // High freq 部分放在后半段
 	}
-	return output
 }
 
-// idwt1D 一维 Haar 逆变换
-func idwt1D(data []float64) []float64 {
+// idwt1D 一维 Haar 逆变换，结果写入 output
+func idwt1D(output, data []float64) {
 	n := len(data)
 	half := n / 2
-	output := make([]float64, n)
 
 	for i := 0; i < half; i++ {
 		// 逆公式:
@@ -122,5 +159,4 @@ func idwt1D(data []float64) []float64 {
 		output[2*i] = (L + H) / Sqrt2
 		output[2*i+1] = (L - H) / Sqrt2
 	}
-	return output
 }
@@ -2,178 +2,437 @@ package core
 
 import (
 	"image"
-	"image/color"
+	"image/draw"
+	"slices"
+)
+
+// Subband 用于嵌入的 DWT 子带，可以按位组合
+type Subband int
+
+const (
+	SubbandHL Subband = 1 << iota // 水平细节 (右上)
+	SubbandLH                     // 垂直细节 (左下)
+	SubbandHH                     // 对角细节 (右下)，容量大但最容易被 JPEG 量化抹掉
 )
 
 // Engine 负责具体的嵌入和提取逻辑
 type Engine struct {
-	Strength float64 // 水印强度 (Alpha)
+	Strength       float64     // 水印强度 (Alpha)
+	SyncStrength   float64     // 几何同步模板的幅度，0 表示不嵌入模板 (此时 ExtractResync 无法校正几何变换)
+	Subbands       Subband     // 使用的子带，0 表示只用 HL
+	Levels         int         // DWT 分解级数，0 表示 1 级，最多 MaxLevels 级；级数越深越抗 JPEG，但每多一级容量变为 1/4
+	Wavelet        Wavelet     // 小波基，nil 表示 Haar；更平滑的小波 (DB4、CDF97 等) 失真更不明显
+	Workers        int         // 并发数，0 表示 runtime.GOMAXPROCS(0)，1 表示串行；结果与并发数无关
+	TileSize       int         // 分块边长 (像素)，0 表示整图一次处理；大于 0 时按块独立嵌入，每块一份完整的 bits，见 tile.go
+	Refine         int         // 嵌入后校验的最大轮数：从写好的像素中重新提取，对被截断削弱的位补嵌，0 表示不校验
+	BlockSize      int         // DCT 分块边长，可选 4、8、16，0 (及其他取值) 表示 8；小块容量大，适合缩略图，大块更抗压缩和打印
+	Pairs          [][2][2]int // 候选的 DCT 系数对 (块内的 [行, 列]，须小于 BlockSize)，nil 表示默认的五对中频系数；提取时须相同，见 key.go
+	BitsPerBlock   int         // 每个 DCT 块写入的 bit 数，0 表示 1；每位使用不同的系数对，不超过 len(Pairs)，STDM 下只能为 1
+	Modulation     Modulation  // 调制方式，默认为系数对；QIM / STDM 见 modulation.go
+	Step           float64     // QIM / STDM 的量化步长，0 表示按 JPEG 质量 75 选择 (见 StepForQuality)；此时 Strength 不起作用
+	Adaptive       bool        // 按 JND 模型逐块调整强度：平坦区域减弱、纹理和暗部加强，Strength 为中等纹理处的强度，见 jnd.go
+	Chroma         Channel     // 额外承载数据的色度通道，0 表示只用 Y；容量按通道数成倍增加，见 chroma.go
+	ChromaStrength float64     // 色度通道的强度，0 表示 Strength 的一半
+	Redundant      bool        // 是否把 bits 循环平铺到全部容量上，提取时可多数表决
+	Key            []byte      // 密钥，非空时块顺序、系数对和白化序列都由密钥决定，见 key.go
+}
+
+// Capacity 返回 width x height 的彩色图片最多能嵌入的 bit 数
+// 分块模式下为一个完整分块的容量；使用色度通道时为各通道之和，灰度图片只有 Y，见 ImageCapacity
+func (e *Engine) Capacity(width, height int) int {
+	return e.capacity(width, height, nil)
+}
+
+// ImageCapacity 返回图片 img 最多能嵌入的 bit 数，与 Capacity 相同，但灰度图片不计色度通道
+func (e *Engine) ImageCapacity(img image.Image) int {
+	return e.capacity(img.Bounds().Dx(), img.Bounds().Dy(), img)
+}
+
+func (e *Engine) capacity(width, height int, img image.Image) int {
+	if t := e.tileSize(); t > 0 {
+		width, height = min(width, t), min(height, t)
+	}
+	return len(e.blockPositions(e.dims(width, height))) * e.bitsPerBlock() * len(e.channels(img))
+}
+
+// MaxLevels 支持的最大 DWT 分解级数：8 级时一个块对应原图 2048 像素 (8x8 分块)，再深已没有实际意义
+const MaxLevels = 8
+
+// levels 实际的 DWT 分解级数，超过 MaxLevels 时按 MaxLevels 处理
+func (e *Engine) levels() int {
+	return min(max(e.Levels, 1), MaxLevels)
+}
+
+// MinSize 能嵌入数据的最小宽高 (像素)：最深一级的每个子带至少放得下一个 DCT 块
+// 宽或高小于它时 Capacity 为 0
+func (e *Engine) MinSize() int {
+	return e.grid()
+}
+
+// blockSize 实际的 DCT 分块边长
+func (e *Engine) blockSize() int {
+	switch e.BlockSize {
+	case 4, 16:
+		return e.BlockSize
+	}
+	return N
+}
+
+// dims 参与变换的区域大小：每一级 DWT 都要求宽高为偶数，因此裁剪到 2^levels 的整数倍
+func (e *Engine) dims(width, height int) (w, h int) {
+	align := 1 << e.levels()
+	return width - width%align, height - height%align
+}
+
+// blockPositions 按扫描顺序返回 DWT 矩阵中各 DCT 块的左上角坐标 (X 为列, Y 为行)
+// 使用最深一级的子带，依次为 HL (右上)、LH (左下)、HH (右下)，子带内部按行扫描
+func (e *Engine) blockPositions(w, h int) []image.Point {
+	subbands := e.Subbands
+	if subbands == 0 {
+		subbands = SubbandHL
+	}
+	halfH := h >> e.levels()
+	halfW := w >> e.levels()
+	n := e.blockSize()
+
+	var positions []image.Point
+	scan := func(top, left int) {
+		for i := top; i <= top+halfH-n; i += n {
+			for j := left; j <= left+halfW-n; j += n {
+				positions = append(positions, image.Pt(j, i))
+			}
+		}
+	}
+	if subbands&SubbandHL != 0 {
+		scan(0, halfW)
+	}
+	if subbands&SubbandLH != 0 {
+		scan(halfH, 0)
+	}
+	if subbands&SubbandHH != 0 {
+		scan(halfH, halfW)
+	}
+	return positions
 }
 
-// Embed 将 bits 嵌入到 img 中
 // Embed 将 bits 嵌入到 img 中 (DWT + DCT 版)
 func (e *Engine) Embed(img image.Image, bits []bool) image.Image {
+	if e.tileSize() > 0 {
+		return e.embedTiled(img, bits)
+	}
 	bounds := img.Bounds()
-	width, height := bounds.Dx(), bounds.Dy()
-
-	// DWT 要求宽高必须是偶数，且最好是 2 的幂。为了简单，我们裁剪到偶数
-	w := width - (width % 2)
-	h := height - (height % 2)
-
-	// 1. 提取 Y 通道 (整张图)
-	yMatrix := make([][]float64, h)
-	for i := 0; i < h; i++ {
-		yMatrix[i] = make([]float64, w)
-		for j := 0; j < w; j++ {
-			r, g, b, _ := img.At(j, i).RGBA()
-			yMatrix[i][j] = 0.299*float64(r>>8) + 0.587*float64(g>>8) + 0.114*float64(b>>8)
+
+	// 输出与输入等大，左上角为 (0, 0)，像素格式与源图对应 (见 pixel.go)。
+	// DWT 要求宽高必须是偶数 (多级分解时为 2^levels 的倍数)，多出来的最后几行 / 列不参与变换，原样复制
+	out := e.newOutput(img, image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	w, h := e.dims(bounds.Dx(), bounds.Dy())
+	copyEdges(out, img, w, h)
+	e.embedRegion(img, bits, bounds, out, bounds.Min)
+	return out
+}
+
+// copyEdges 把 img 中超出 w x h 的右侧列和底部行原样复制到 out 的对应位置 (以 img 左上角为原点)
+func copyEdges(out image.Image, img image.Image, w, h int) {
+	bounds := img.Bounds()
+	copyRect(out, image.Rect(w, 0, bounds.Dx(), bounds.Dy()), img, bounds.Min.Add(image.Pt(w, 0)))
+	copyRect(out, image.Rect(0, h, w, bounds.Dy()), img, bounds.Min.Add(image.Pt(0, h)))
+}
+
+// copyRect 把 img 中以 sp 为左上角的像素原样复制到 out 的区域 r
+// YCbCr 输出在 newOutput 中已经复制过，无需处理
+func copyRect(out image.Image, r image.Rectangle, img image.Image, sp image.Point) {
+	if dst, ok := out.(draw.Image); ok {
+		draw.Draw(dst, r, img, sp, draw.Src)
+	}
+}
+
+// refineMargin 校验时软判决值低于它的位需要补嵌
+// 取 1 以下留出余量：像素取整本身会让系数差有零点几的出入，不必为此反复修补
+const refineMargin = 0.75
+
+// embedRegion 把 bits 嵌入 img 的区域 r (按 dims 裁剪)，结果写入 out
+// img 中的像素 p 写到 out 的 p - offset 处，同步模板的相位也以 offset 为原点，保证各分块的模板连成一片
+// 设置了 Refine 时，写好之后再从 out 中提取一遍：高光、暗部的像素被截断后，
+// 部分位的系数差达不到 Strength，这些位在 out 上原地补嵌，直到全部达标或用完轮数
+func (e *Engine) embedRegion(img image.Image, bits []bool, r image.Rectangle, out image.Image, offset image.Point) {
+	slots := e.slots(e.dims(r.Dx(), r.Dy()))
+	planes := e.embedPass(img, bits, r, out, offset, slots)
+	if len(bits) == 0 {
+		return
+	}
+	dst := r.Sub(offset)
+	for range e.Refine {
+		if !e.refinePass(out, bits, dst, slots, planes) {
+			return
 		}
 	}
+}
 
-	// 2. 全局 DWT 变换
-	dwtMatrix := DWT2D(yMatrix)
+// slotRange 第 n 个通道写入的落点数，以及第一个落点对应 bits 中的位置
+// 冗余模式下 bits 被循环写满全部块，否则写完即止
+func (e *Engine) slotRange(n, slots, bits int) (base, count int) {
+	base, count = n*slots, slots
+	if !e.Redundant {
+		count = max(min(count, bits-base), 0)
+	}
+	if bits == 0 {
+		count = 0
+	}
+	return base, count
+}
 
-	// 3. 选择 HL 区域 (右上角) 进行嵌入
-	// HL 的区域范围：行 [0, h/2), 列 [w/2, w)
-	halfH := h / 2
-	halfW := w / 2
+// embedPass 把 bits 嵌入 img 的区域 r 并写入 out，参数同 embedRegion，slots 为区域的全部落点
+// 返回按 Channel 的取值索引的各通道矩阵 (没有分到数据的色度通道为 nil)，补嵌时复用，不再另外分配
+func (e *Engine) embedPass(img image.Image, bits []bool, r image.Rectangle, out image.Image, offset image.Point, slots []slot) []*Matrix {
+	w, h := e.dims(r.Dx(), r.Dy())
+	x0, y0 := r.Min.X, r.Min.Y
 
-	// 我们把 HL 区域当做一个新的“图像”，在里面做 8x8 DCT
-	// 遍历 HL 区域内的 8x8 块
-	bitIdx := 0
-	maxBits := len(bits)
+	planes := make([]*Matrix, 3) // Y 始终处理
+	for n, ch := range e.channels(img) {
+		// 没有分到数据的色度通道保持原样
+		base, count := e.slotRange(n, len(slots), len(bits))
+		if ch != channelY && count == 0 {
+			continue
+		}
 
-	for i := 0; i <= halfH-N; i += N {
-		for j := halfW; j <= w-N; j += N {
-			if bitIdx >= maxBits {
-				break
-			}
+		// 1. 提取通道 (整个区域)。之后的模板、DWT、DCT、IDWT 都在这一个矩阵上原地进行，
+		// 原始的值在合成时从像素重新计算，不另存一份
+		m := e.planeMatrix(img, ch, x0, y0, w, h)
 
-			// 3.1 从 DWT 矩阵中取出 8x8 块
-			block := make([][]float64, N)
-			for bi := 0; bi < N; bi++ {
-				block[bi] = make([]float64, N)
-				for bj := 0; bj < N; bj++ {
-					block[bi][bj] = dwtMatrix[i+bi][j+bj]
-				}
-			}
+		// 1.1 叠加几何同步模板，它与水印一起作为 Y 的变化量写回像素
+		if ch == channelY && e.SyncStrength > 0 {
+			addTemplate(m, e.SyncStrength, r.Min.Sub(offset), e.workers(), e.templateMask(m))
+		}
 
-			// 3.2 DCT 变换
-			dctBlock := SimpleDCT(block)
-
-			// 3.3 修改系数嵌入 (同之前逻辑)
-			v1 := dctBlock[4][3]
-			v2 := dctBlock[3][4]
-			bit := bits[bitIdx]
-
-			if bit {
-				if v1-v2 < e.Strength {
-					diff := (e.Strength - (v1 - v2)) / 2.0
-					v1 += diff
-					v2 -= diff
-				}
-			} else {
-				if v2-v1 < e.Strength {
-					diff := (e.Strength - (v2 - v1)) / 2.0
-					v2 += diff
-					v1 -= diff
-				}
-			}
-			dctBlock[4][3] = v1
-			dctBlock[3][4] = v2
+		// 2. 全局 DWT 变换
+		dwt2DLevels(m, e.levels(), e.Wavelet, e.workers())
 
-			// 3.4 IDCT
-			idctBlock := SimpleIDCT(dctBlock)
+		// 3. 在选定的子带 (默认 HL，右上角) 内做分块 DCT (默认 8x8) 并嵌入
+		e.embedSlots(m, bits, slots[:count], base, e.slotStrengths(m, slots[:count], ch), nil)
 
-			// 3.5 填回 DWT 矩阵 (注意：填回 HL 区域)
-			for bi := 0; bi < N; bi++ {
-				for bj := 0; bj < N; bj++ {
-					dwtMatrix[i+bi][j+bj] = idctBlock[bi][bj]
-				}
+		// 4. 全局 IDWT 反变换
+		idwt2DLevels(m, e.levels(), e.Wavelet, e.workers())
+		planes[ch] = m
+	}
+
+	// 5. 合成最终图片：把新的 Y (以及色度) 写回，alpha 不变 (见 pixel.go)
+	e.writePlanes(out, img, r, offset, planes)
+	return planes
+}
+
+// refinePass 在已经写好的 out 的区域 r 上校验一轮：重新读出各通道，软判决值低于 refineMargin 的落点原地补嵌。
+// 读出、校验和补嵌共用 embedPass 留下的矩阵，同一次 DWT 既用于提取也用于补嵌；
+// 只写回有落点补嵌过的通道，没有需要补嵌的落点时返回 false
+func (e *Engine) refinePass(out image.Image, bits []bool, r image.Rectangle, slots []slot, planes []*Matrix) bool {
+	changed := make([]*Matrix, 3)
+	found := false
+	for n, ch := range e.channels(out) {
+		m := planes[ch]
+		base, count := e.slotRange(n, len(slots), len(bits))
+		if m == nil || count == 0 {
+			continue
+		}
+		e.readPlane(m, out, ch, r.Min.X, r.Min.Y)
+		dwt2DLevels(m, e.levels(), e.Wavelet, e.workers())
+
+		strengths := e.slotStrengths(m, slots[:count], ch)
+		weak := make([]bool, count)
+		for k, v := range e.extractSlots(m, slots[:count], strengths) {
+			if !bits[(base+k)%len(bits)] {
+				v = -v
 			}
+			weak[k] = v < refineMargin
+		}
+		if !slices.Contains(weak, true) {
+			continue
+		}
+		e.embedSlots(m, bits, slots[:count], base, strengths, weak)
+		idwt2DLevels(m, e.levels(), e.Wavelet, e.workers())
+		changed[ch] = m
+		found = true
+	}
+	if found {
+		e.writePlanes(out, out, r, image.Point{}, changed)
+	}
+	return found
+}
 
-			bitIdx++
+// writePlanes 把各通道的新值写回 out：img 中区域 r 的像素 p 写到 out 的 p - offset 处，
+// planes 按 Channel 的取值索引，为 nil 的通道保持不变 (见 pixelSetter)
+func (e *Engine) writePlanes(out, img image.Image, r image.Rectangle, offset image.Point, planes []*Matrix) {
+	w, h := e.dims(r.Dx(), r.Dy())
+	x0, y0 := r.Min.X, r.Min.Y
+	set := pixelSetter(out, img)
+	value := func(m *Matrix, i, j int) float64 {
+		if m == nil {
+			return keep
 		}
+		return m.At(i, j)
 	}
+	parallelFor(e.workers(), h, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			for j := 0; j < w; j++ {
+				set(x0+j-offset.X, y0+i-offset.Y, x0+j, y0+i,
+					value(planes[channelY], i, j), value(planes[ChannelCb], i, j), value(planes[ChannelCr], i, j))
+			}
+		}
+	})
+}
 
-	// 4. 全局 IDWT 反变换
-	reconstructedY := IDWT2D(dwtMatrix)
+// embedSlots 在做过 DWT 的矩阵 m 中嵌入，第 k 个落点写 bits 的第 base + k 位 (冗余模式下循环)
+// 1 级分解时 HL 的区域范围：行 [0, h/2), 列 [w/2, w)；设置了密钥时块的顺序被打乱。
+// strengths 为各落点的强度 (见 slotStrengths)，only 非空时只处理 only[k] 为 true 的落点
+func (e *Engine) embedSlots(m *Matrix, bits []bool, slots []slot, base int, strengths []float64, only []bool) {
+	// 同一个块的落点相邻 (见 slots)，一起做 DCT；各块互不重叠，可以并行处理
+	per, n := e.bitsPerBlock(), e.blockSize()
+	parallelFor(e.workers(), (len(slots)+per-1)/per, func(lo, hi int) {
+		for g := lo; g < hi; g++ {
+			first := g * per
+			last := min(first+per, len(slots))
+			if only != nil && !slices.Contains(only[first:last], true) {
+				continue
+			}
+			i, j := slots[first].pos.Y, slots[first].pos.X
 
-	// 5. 合成最终图片
-	out := image.NewRGBA(image.Rect(0, 0, w, h))
-	for i := 0; i < h; i++ {
-		for j := 0; j < w; j++ {
-			origR, origG, origB, _ := img.At(j, i).RGBA()
+			// 3.1 从 DWT 矩阵中取出 n x n 块
+			var buf [MaxBlockSize * MaxBlockSize]float64
+			block := buf[:n*n]
+			m.block(i, j, n, block)
 
-			oldY := yMatrix[i][j]
-			newY := reconstructedY[i][j]
-			diff := newY - oldY // 算出 Y 的变化量
+			// 3.2 DCT 变换
+			FastDCT(block, n)
 
-			// 将变化量加回 RGB
-			r := clamp(float64(origR>>8) + diff)
-			g := clamp(float64(origG>>8) + diff)
-			b := clamp(float64(origB>>8) + diff)
+			// 3.3 修改系数嵌入 (调制方式见 modulation.go)
+			for k := first; k < last; k++ {
+				if only != nil && !only[k] {
+					continue
+				}
+				bit := bits[(base+k)%len(bits)] != slots[k].flip
+				e.modulate(block, slots[k], bit, strengths[k])
+			}
 
-			out.Set(j, i, color.RGBA{R: r, G: g, B: b, A: 255})
-		}
-	}
+			// 3.4 IDCT
+			FastIDCT(block, n)
 
-	return out
+			// 3.5 填回 DWT 矩阵 (注意：填回原子带区域)
+			m.setBlock(i, j, n, block)
+		}
+	})
 }
 
 // Extract 从图片中提取 bits
 func (e *Engine) Extract(img image.Image) []bool {
+	return HardBits(e.ExtractSoft(img))
+}
+
+// ExtractSoft 从图片中提取软判决值
+// 每个值为 (v1 - v2) / Strength (自适应模式下为该块的实际强度)：正数表示 1，负数表示 0，
+// 绝对值是以嵌入强度归一化的系数差，可作为对数似然比 (LLR) 式的置信度。
+// 未受攻击时绝对值约为 1 (像素取整会带来零点几的出入)，越接近 0 越不可信。QIM / STDM 模式下由离格点的距离换算，取值 [-1, 1]
+// 分块模式下各分块的软判决值按位置取平均
+func (e *Engine) ExtractSoft(img image.Image) []float64 {
 	bounds := img.Bounds()
-	width, height := bounds.Dx(), bounds.Dy()
-	w := width - (width % 2)
-	h := height - (height % 2)
-
-	// 1. 提取 Y
-	yMatrix := make([][]float64, h)
-	for i := 0; i < h; i++ {
-		yMatrix[i] = make([]float64, w)
-		for j := 0; j < w; j++ {
-			r, g, b, _ := img.At(j, i).RGBA()
-			yMatrix[i][j] = 0.299*float64(r>>8) + 0.587*float64(g>>8) + 0.114*float64(b>>8)
-		}
+	if e.tileSize() > 0 {
+		return e.extractTiles(img, bounds.Min, false)
 	}
+	return e.extractRegion(img, bounds)
+}
 
-	// 2. DWT
-	dwtMatrix := DWT2D(yMatrix)
+// extractRegion 从 img 的区域 r (按 dims 裁剪) 中提取软判决值
+func (e *Engine) extractRegion(img image.Image, r image.Rectangle) []float64 {
+	w, h := e.dims(r.Dx(), r.Dy())
 
-	// 3. 遍历 HL 区域 (右上)
-	halfH := h / 2
-	halfW := w / 2
-	var bits []bool
+	slots := e.slots(w, h)
+	soft := make([]float64, 0, len(slots)*len(e.channels(img)))
+	for _, ch := range e.channels(img) {
+		// 1. 提取通道
+		m := e.planeMatrix(img, ch, r.Min.X, r.Min.Y, w, h)
 
-	for i := 0; i <= halfH-N; i += N {
-		for j := halfW; j <= w-N; j += N {
-			// 提取 8x8
-			block := make([][]float64, N)
-			for bi := 0; bi < N; bi++ {
-				block[bi] = make([]float64, N)
-				for bj := 0; bj < N; bj++ {
-					block[bi][bj] = dwtMatrix[i+bi][j+bj]
-				}
-			}
+		// 2. DWT (原地)
+		dwt2DLevels(m, e.levels(), e.Wavelet, e.workers())
 
-			// DCT
-			dctBlock := SimpleDCT(block)
+		// 3. 按嵌入顺序遍历各落点，各通道依次排列
+		soft = append(soft, e.extractSlots(m, slots, e.slotStrengths(m, slots, ch))...)
+	}
+	return soft
+}
 
-			// 比较
-			v1 := dctBlock[4][3]
-			v2 := dctBlock[3][4]
+// extractSlots 从做过 DWT 的矩阵 m 中按顺序读出各落点的软判决值，按各落点的强度归一化
+func (e *Engine) extractSlots(m *Matrix, slots []slot, strengths []float64) []float64 {
+	soft := make([]float64, len(slots))
+	per, n := e.bitsPerBlock(), e.blockSize()
+	parallelFor(e.workers(), (len(slots)+per-1)/per, func(lo, hi int) {
+		for g := lo; g < hi; g++ {
+			first := g * per
+			last := min(first+per, len(slots))
+			i, j := slots[first].pos.Y, slots[first].pos.X
+
+			// 提取 n x n
+			var buf [MaxBlockSize * MaxBlockSize]float64
+			block := buf[:n*n]
+			m.block(i, j, n, block)
+
+			// DCT
+			FastDCT(block, n)
 
-			if v1 >= v2 {
-				bits = append(bits, true)
-			} else {
-				bits = append(bits, false)
+			// 比较，并去掉白化
+			for k := first; k < last; k++ {
+				v := e.demodulate(block, slots[k], strengths[k])
+				if slots[k].flip {
+					v = -v
+				}
+				soft[k] = v
 			}
 		}
+	})
+	return soft
+}
+
+// HardBits 把软判决值转换为 bits (硬判决)，0 视为 1
+func HardBits(soft []float64) []bool {
+	bits := make([]bool, len(soft))
+	for i, v := range soft {
+		bits[i] = v >= 0
 	}
 	return bits
 }
 
+// lumaMatrix 读取以 (x0, y0) 为左上角、w x h 区域的 Y (亮度) 通道，按行并行
+// YCbCr 图片直接读 Y 平面
+func (e *Engine) lumaMatrix(img image.Image, x0, y0, w, h int) *Matrix {
+	m := NewMatrix(h, w)
+	e.readLuma(m, img, x0, y0)
+	return m
+}
+
+// readLuma 同 lumaMatrix，读入已有的矩阵 m，区域大小为 m 的大小
+func (e *Engine) readLuma(m *Matrix, img image.Image, x0, y0 int) {
+	ycc, _ := img.(*image.YCbCr)
+	read := pixelReader(img)
+	parallelFor(e.workers(), m.Rows, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			row := m.Row(i)
+			if ycc != nil {
+				for j, v := range ycc.Y[ycc.YOffset(x0, y0+i):][:len(row)] {
+					row[j] = float64(v)
+				}
+				continue
+			}
+			for j := range row {
+				row[j] = luma(read(x0+j, y0+i))
+			}
+		}
+	})
+}
+
+// luma 像素的 Y (亮度)，按非预乘的颜色计算，半透明像素的亮度不受 alpha 影响
+func luma(r, g, b float64, _ uint32) float64 {
+	return 0.299*r + 0.587*g + 0.114*b
+}
+
+// clamp 截断到 [0, 255] 并四舍五入
+// 不直接舍去小数：Y 与 RGB 之间的浮点换算会让没有改动的像素变成 99.99999 这样的值，舍去小数会使其减 1；
+// 舍去还让所有像素平均偏暗半个灰阶，最大误差也是四舍五入的两倍，系数差更难达到 Strength
 func clamp(v float64) uint8 {
 	if v < 0 {
 		return 0
@@ -181,5 +440,5 @@ func clamp(v float64) uint8 {
 	if v > 255 {
 		return 255
 	}
-	return uint8(v)
+	return uint8(v + 0.5)
 }
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"blindwatermark/internal/testimage"
+	"bytes"
+	"image"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+func TestEmbedExtract(t *testing.T) {
+	e := &Engine{Strength: 20}
+	src := testimage.Photo(t, 512, 384)
+	bits := randomBits(e.Capacity(512, 384), 1)
+	marked := e.Embed(src, bits)
+	if marked.Bounds() != src.Bounds() {
+		t.Fatalf("output bounds %v, want %v", marked.Bounds(), src.Bounds())
+	}
+	if ber := bitErrorRate(e.ExtractSoft(marked), bits); ber != 0 {
+		t.Errorf("BER %.4f on an untouched image", ber)
+	}
+}
+
+// TestEmbedRedundant 冗余模式下短 bits 被循环写满全部容量，每一份副本都能单独读出
+func TestEmbedRedundant(t *testing.T) {
+	e := &Engine{Strength: 20, Redundant: true}
+	bits := randomBits(37, 2)
+	soft := e.ExtractSoft(e.Embed(testimage.Photo(t, 512, 384), bits))
+	if len(soft) != e.Capacity(512, 384) {
+		t.Fatalf("extracted %d values, capacity is %d", len(soft), e.Capacity(512, 384))
+	}
+	tiled := make([]bool, len(soft))
+	for k := range tiled {
+		tiled[k] = bits[k%len(bits)]
+	}
+	if ber := bitErrorRate(soft, tiled); ber != 0 {
+		t.Errorf("BER %.4f over all copies", ber)
+	}
+}
+
+// TestEmbedRedundantJPEG JPEG 压缩后单份副本有误码，按位把各副本的软判决值相加后误码率明显下降
+func TestEmbedRedundantJPEG(t *testing.T) {
+	e := &Engine{Strength: 20, Redundant: true}
+	bits := randomBits(64, 3)
+	soft := e.ExtractSoft(testimage.JPEGRoundTrip(t, e.Embed(testimage.Photo(t, 512, 384), bits), 75))
+
+	single := bitErrorRate(soft, bits)
+	voted := make([]float64, len(bits))
+	for k, v := range soft {
+		voted[k%len(bits)] += v
+	}
+	combined := bitErrorRate(voted, bits)
+	t.Logf("single copy BER %.4f, combined BER %.4f", single, combined)
+	if combined > single/2 {
+		t.Errorf("combining copies did not help: single %.4f, combined %.4f", single, combined)
+	}
+}
+
+// TestExtractSoft 软判决值的符号与 Extract 一致；未受攻击时绝对值约为 1，压缩后整体变小
+func TestExtractSoft(t *testing.T) {
+	e := &Engine{Strength: 20, Refine: 2}
+	bits := randomBits(e.Capacity(512, 384), 4)
+	marked := e.Embed(testimage.Photo(t, 512, 384), bits)
+	soft := e.ExtractSoft(marked)
+	hard := e.Extract(marked)
+	for k, v := range soft {
+		if hard[k] != (v >= 0) {
+			t.Fatalf("bit %d: Extract %v, soft %.3f", k, hard[k], v)
+		}
+		if math.Abs(v) < 0.5 {
+			t.Fatalf("bit %d: |soft| = %.3f on an untouched image", k, math.Abs(v))
+		}
+	}
+	if mean := meanAbs(soft); math.Abs(mean-1) > 0.1 {
+		t.Errorf("mean |soft| = %.3f on an untouched image", mean)
+	}
+	if meanAbs(e.ExtractSoft(testimage.JPEGRoundTrip(t, marked, 75))) >= meanAbs(soft) {
+		t.Error("JPEG compression did not lower the confidence")
+	}
+}
+
+func meanAbs(soft []float64) float64 {
+	sum := 0.0
+	for _, v := range soft {
+		sum += math.Abs(v)
+	}
+	return sum / float64(len(soft))
+}
+
+// TestEmbedSubImage 左上角不在 (0, 0) 的 SubImage：输出左上角为 (0, 0) 且与输入等大，
+// 水印和直接嵌入左上角在原点的同样内容时逐像素相同
+func TestEmbedSubImage(t *testing.T) {
+	e := &Engine{Strength: 20}
+	canvas := testimage.Photo(t, 640, 480)
+	sub := canvas.SubImage(image.Rect(13, 7, 13+301, 7+203)).(*image.RGBA) // 宽高都是奇数
+	bits := randomBits(e.Capacity(301, 203), 3)
+
+	marked := e.Embed(sub, bits).(*image.RGBA)
+	if marked.Rect != image.Rect(0, 0, 301, 203) {
+		t.Fatalf("output bounds %v, want (0,0)-(301,203)", marked.Rect)
+	}
+	rebased := image.NewRGBA(marked.Rect)
+	draw.Draw(rebased, rebased.Rect, sub, sub.Rect.Min, draw.Src)
+	if !bytes.Equal(e.Embed(rebased, bits).(*image.RGBA).Pix, marked.Pix) {
+		t.Error("embedding a SubImage differs from embedding the same pixels at the origin")
+	}
+
+	// 放回画布后按 SubImage 提取
+	draw.Draw(canvas, sub.Rect, marked, image.Point{}, draw.Src)
+	if ber := bitErrorRate(e.ExtractSoft(canvas.SubImage(sub.Rect)), bits); ber != 0 {
+		t.Errorf("BER %.4f extracting from a SubImage", ber)
+	}
+}
+
+// TestEmbedOddSize 宽高不是 2^levels 的倍数时，多出来的右侧列和底部行原样保留
+func TestEmbedOddSize(t *testing.T) {
+	for _, levels := range []int{1, 3} {
+		e := &Engine{Strength: 20, Levels: levels}
+		src := testimage.Photo(t, 403, 301)
+		w, h := e.dims(403, 301)
+		if w == 403 || h == 301 {
+			t.Fatalf("levels %d: %dx%d has no edge to keep", levels, w, h)
+		}
+		marked := e.Embed(src, randomBits(e.Capacity(403, 301), 4)).(*image.RGBA)
+		if marked.Rect != src.Rect {
+			t.Fatalf("levels %d: output bounds %v, want %v", levels, marked.Rect, src.Rect)
+		}
+		for y := range 301 {
+			for x := range 403 {
+				if (x >= w || y >= h) && marked.RGBAAt(x, y) != src.RGBAAt(x, y) {
+					t.Fatalf("levels %d: edge pixel (%d, %d) changed", levels, x, y)
+				}
+			}
+		}
+	}
+}
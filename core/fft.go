@@ -0,0 +1,68 @@
+package core
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// fft1D 原地进行一维基 2 快速傅里叶变换
+// 输入长度必须是 2 的幂
+func fft1D(data []complex128) {
+	n := len(data)
+
+	// 1. 位反转重排
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			data[i], data[j] = data[j], data[i]
+		}
+	}
+
+	// 2. 蝶形运算
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a := data[start+k]
+				b := data[start+k+size/2] * w
+				data[start+k] = a + b
+				data[start+k+size/2] = a - b
+				w *= step
+			}
+		}
+	}
+}
+
+// FFT2D 对方阵做二维快速傅里叶变换，返回频谱
+// 输入边长必须是 2 的幂，结果中 [v][u] 对应竖直频率 v、水平频率 u
+func FFT2D(matrix [][]float64) [][]complex128 {
+	n := len(matrix)
+
+	// 1. 行变换
+	output := make([][]complex128, n)
+	for i := 0; i < n; i++ {
+		output[i] = make([]complex128, n)
+		for j := 0; j < n; j++ {
+			output[i][j] = complex(matrix[i][j], 0)
+		}
+		fft1D(output[i])
+	}
+
+	// 2. 列变换
+	col := make([]complex128, n)
+	for j := 0; j < n; j++ {
+		for i := 0; i < n; i++ {
+			col[i] = output[i][j]
+		}
+		fft1D(col)
+		for i := 0; i < n; i++ {
+			output[i][j] = col[i]
+		}
+	}
+	return output
+}
@@ -0,0 +1,86 @@
+package core
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand/v2"
+)
+
+// 测试用的公共工具：合成图片、随机 bits、误码率和 PSNR；示例照片、JPEG 压缩和几何变换见 internal/testimage
+
+// synthPhoto 合成的带纹理的图片：base 为平均亮度，sat 为饱和度，用于测试高光、暗部等示例照片中少见的情形
+func synthPhoto(w, h int, base, sat float64, seed uint64) *image.RGBA {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	c := func(v float64) uint8 { return uint8(math.Max(0, math.Min(255, v))) }
+	for y := range h {
+		for x := range w {
+			l := base + math.Sin(float64(x)/37)*math.Cos(float64(y)/23)*30 + rng.NormFloat64()*6
+			r := l + sat*math.Sin(float64(x+y)/80)
+			g := l - sat*0.5*math.Cos(float64(x)/60)
+			b := l - sat*math.Sin(float64(y)/50)
+			img.SetRGBA(x, y, color.RGBA{c(r), c(g), c(b), 255})
+		}
+	}
+	return img
+}
+
+// skyOverTexture 上半部分为平滑渐变的天空、下半部分为强纹理的图片，用于比较平坦区域和纹理区域的失真
+func skyOverTexture(w, h int) *image.RGBA {
+	rng := rand.New(rand.NewPCG(5, 5))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	c := func(v float64) uint8 { return uint8(math.Max(0, math.Min(255, v+0.5))) }
+	for y := range h {
+		for x := range w {
+			var r, g, b float64
+			if y < h/2 {
+				// 带少许传感器噪声：完全无噪声的纵向渐变经 JPEG 后每行都是常数，HL 子带直接归零
+				t, n := float64(y)/float64(h/2), rng.NormFloat64()*1.5
+				r, g, b = 90+60*t+n, 140+50*t+n, 220+20*t+n
+			} else {
+				l := 90 + 50*math.Sin(float64(x)/5)*math.Cos(float64(y)/7) + rng.NormFloat64()*25
+				r, g, b = l*0.9, l, l*0.6
+			}
+			img.SetRGBA(x, y, color.RGBA{c(r), c(g), c(b), 255})
+		}
+	}
+	return img
+}
+
+// randomBits n 个固定种子的随机 bit
+func randomBits(n int, seed uint64) []bool {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	bits := make([]bool, n)
+	for i := range bits {
+		bits[i] = rng.IntN(2) == 1
+	}
+	return bits
+}
+
+// bitErrorRate 软判决值 soft 的前 len(bits) 位与 bits 的误码率
+func bitErrorRate(soft []float64, bits []bool) float64 {
+	errors := 0
+	for i, bit := range bits {
+		if (soft[i] >= 0) != bit {
+			errors++
+		}
+	}
+	return float64(errors) / float64(len(bits))
+}
+
+// psnr a、b 在 a 的范围内 R、G、B 的 PSNR (dB)，两者的左上角都应为 (0, 0)
+func psnr(a, b image.Image) float64 {
+	var se float64
+	r := a.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			r1, g1, b1, _ := a.At(x, y).RGBA()
+			r2, g2, b2, _ := b.At(x, y).RGBA()
+			for _, d := range [3]float64{float64(r1) - float64(r2), float64(g1) - float64(g2), float64(b1) - float64(b2)} {
+				se += d * d / (257 * 257)
+			}
+		}
+	}
+	return 10 * math.Log10(255*255*3*float64(r.Dx()*r.Dy())/math.Max(se, 1e-9))
+}
@@ -0,0 +1,99 @@
+package core
+
+import "math"
+
+// 自适应强度 (Engine.Adaptive)：
+// 人眼对平坦区域 (天空、渐变) 中的噪声最敏感，纹理丰富和很暗的区域则能掩盖较大的改动。
+// 固定强度在平坦区域造成可见的色带，在纹理区域又没有用足余量。自适应模式按 JND (恰可察觉差) 模型
+// 给每个块一个系数，实际强度为 Strength 乘以该系数：
+//   - 亮度掩蔽：Chou & Li 的背景亮度 JND 曲线，以中灰 (127) 为 1，暗部和高光加强
+//   - 纹理掩蔽：块内亮度的标准差与 jndTexture 之比的平方根，平坦区域减弱，纹理区域加强
+// 两个特征都从最深一级 LL 子带中与该块位置对应的同样大小的块计算。嵌入只改动细节子带，LL 不变，
+// 提取端从含水印的图片中能算出同样的系数，软判决值照常按实际强度归一化，不需要额外的信息。
+// 同步模板在平坦区域同样显眼 (幅度 1 时单独就让 PSNR 降到 42 dB 左右)，自适应模式下按纹理逐块减弱，
+// 但不超过设定的幅度；模板峰值来自整张图，纹理区域的部分足以让 ExtractResync 找到它
+
+const (
+	jndBlock     = 16   // 同步模板幅度系数的块大小 (像素)
+	jndTexture   = 12.0 // 系数为 1 的纹理强度 (块内亮度标准差)
+	jndMinFactor = 0.5  // 系数下限，平坦区域至少保留的强度比例
+	jndMaxFactor = 2.5  // 系数上限
+)
+
+// slotStrengths 各落点的实际强度，m 为通道 ch 做过 DWT 的矩阵
+// 只有 Y 通道使用自适应强度，色度通道和未开启 Adaptive 时都是固定值
+func (e *Engine) slotStrengths(m *Matrix, slots []slot, ch Channel) []float64 {
+	strengths := make([]float64, len(slots))
+	base := e.strength(ch)
+	if !e.Adaptive || ch != channelY {
+		for k := range strengths {
+			strengths[k] = base
+		}
+		return strengths
+	}
+
+	levels := e.levels()
+	ll := m.View(0, 0, m.Rows>>levels, m.Cols>>levels)
+	gain := float64(int(1) << levels) // 每一级 DWT 把 LL 放大 2 倍
+	n := e.blockSize()
+	parallelFor(e.workers(), len(slots), func(lo, hi int) {
+		for k := lo; k < hi; k++ {
+			var buf [MaxBlockSize * MaxBlockSize]float64
+			block := buf[:n*n]
+			ll.block(slots[k].pos.Y%ll.Rows, slots[k].pos.X%ll.Cols, n, block)
+			strengths[k] = base * jndFactor(block, gain)
+		}
+	})
+	return strengths
+}
+
+// jndFactor LL 子带中一个块对应的强度系数，gain 为 LL 相对像素值的放大倍数
+func jndFactor(block []float64, gain float64) float64 {
+	var sum, sumSq float64
+	for _, v := range block {
+		v /= gain
+		sum += v
+		sumSq += v * v
+	}
+	count := float64(len(block))
+	mean := sum / count
+	std := math.Sqrt(math.Max(sumSq/count-mean*mean, 0))
+
+	// 亮度掩蔽 (Chou & Li)，中灰处为 3
+	bg := min(max(mean, 0), 255)
+	jl := 3 + 3*(bg-127)/128
+	if bg <= 127 {
+		jl = 3 + 17*(1-math.Sqrt(bg/127))
+	}
+	// 曲线在纯黑处达到中灰的 6.7 倍，开平方缓和
+	luminance := math.Sqrt(jl / 3)
+	texture := math.Sqrt(std / jndTexture)
+	return min(max(luminance*texture, jndMinFactor), jndMaxFactor)
+}
+
+// templateMask 自适应模式下同步模板的逐块幅度系数，m 为叠加模板之前的 Y，未开启 Adaptive 时返回 nil
+// 每个 jndBlock x jndBlock 的块按亮度标准差取纹理掩蔽系数，上限为 1
+func (e *Engine) templateMask(m *Matrix) *Matrix {
+	if !e.Adaptive {
+		return nil
+	}
+	mask := NewMatrix((m.Rows+jndBlock-1)/jndBlock, (m.Cols+jndBlock-1)/jndBlock)
+	parallelFor(e.workers(), mask.Rows, func(lo, hi int) {
+		for bi := lo; bi < hi; bi++ {
+			for bj := range mask.Cols {
+				var sum, sumSq float64
+				view := m.View(bi*jndBlock, bj*jndBlock, min(jndBlock, m.Rows-bi*jndBlock), min(jndBlock, m.Cols-bj*jndBlock))
+				for i := range view.Rows {
+					for _, v := range view.Row(i) {
+						sum += v
+						sumSq += v * v
+					}
+				}
+				n := float64(view.Rows * view.Cols)
+				std := math.Sqrt(math.Max(sumSq/n-sum*sum/(n*n), 0))
+				mask.Set(bi, bj, min(max(math.Sqrt(std/jndTexture), jndMinFactor), 1))
+			}
+		}
+	})
+	return mask
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"blindwatermark/internal/testimage"
+	"fmt"
+	"image"
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+// jndBlockOf 均值为 mean、标准差约为 std 的 8x8 块，按 gain 放大 (模拟 LL 子带)
+func jndBlockOf(mean, std, gain float64) []float64 {
+	rng := rand.New(rand.NewPCG(1, 1))
+	block := make([]float64, 64)
+	for i := range block {
+		block[i] = (mean + std*rng.NormFloat64()) * gain
+	}
+	return block
+}
+
+func TestJNDFactor(t *testing.T) {
+	// 平坦区域落到下限，纹理越强系数越大，直到上限
+	if f := jndFactor(jndBlockOf(127, 0, 2), 2); f != jndMinFactor {
+		t.Errorf("flat mid-grey block: factor %v, want %v", f, jndMinFactor)
+	}
+	prev := 0.0
+	for _, std := range []float64{4, 12, 30} {
+		f := jndFactor(jndBlockOf(127, std, 2), 2)
+		if f <= prev {
+			t.Errorf("std %v: factor %v, not above %v", std, f, prev)
+		}
+		prev = f
+	}
+	if f := jndFactor(jndBlockOf(127, 200, 2), 2); f != jndMaxFactor {
+		t.Errorf("very strong texture: factor %v, want %v", f, jndMaxFactor)
+	}
+	// 同样的纹理，暗部的系数大于中灰
+	if dark, mid := jndFactor(jndBlockOf(15, 8, 4), 4), jndFactor(jndBlockOf(127, 8, 4), 4); dark <= mid {
+		t.Errorf("dark block factor %v, mid-grey %v", dark, mid)
+	}
+}
+
+// TestAdaptive 自适应模式把失真从平坦区域转移到纹理区域，提取端算出同样的系数，软判决值仍约为 ±1
+func TestAdaptive(t *testing.T) {
+	src := skyOverTexture(512, 512)
+	sky := src.SubImage(image.Rect(0, 0, 512, 256))
+	ground := src.SubImage(image.Rect(0, 256, 512, 512))
+	var skyPSNR, groundPSNR [2]float64
+	for i, adaptive := range []bool{false, true} {
+		e := &Engine{Strength: 20, Refine: 2, Adaptive: adaptive}
+		bits := randomBits(e.Capacity(512, 512), 13)
+		out := e.Embed(src, bits)
+		soft := e.ExtractSoft(out)
+		if ber := bitErrorRate(soft, bits); ber != 0 {
+			t.Errorf("adaptive=%v: BER %.4f", adaptive, ber)
+		}
+		if m := meanAbs(soft); math.Abs(m-1) > 0.15 {
+			t.Errorf("adaptive=%v: mean |soft| %.3f, want about 1", adaptive, m)
+		}
+		skyPSNR[i], groundPSNR[i] = psnr(sky, out), psnr(ground, out)
+	}
+	t.Logf("sky %.1f -> %.1f dB, texture %.1f -> %.1f dB", skyPSNR[0], skyPSNR[1], groundPSNR[0], groundPSNR[1])
+	if skyPSNR[1] < skyPSNR[0]+3 || groundPSNR[1] > groundPSNR[0] {
+		t.Errorf("sky %.1f -> %.1f dB, texture %.1f -> %.1f dB", skyPSNR[0], skyPSNR[1], groundPSNR[0], groundPSNR[1])
+	}
+}
+
+// TestTemplateMask 同步模板的幅度系数在平坦区域减弱，纹理区域不超过 1；未开启 Adaptive 时不使用
+func TestTemplateMask(t *testing.T) {
+	src := skyOverTexture(256, 256)
+	y := (&Engine{}).lumaMatrix(src, 0, 0, 256, 256)
+	if (&Engine{}).templateMask(y) != nil {
+		t.Fatal("template mask without Adaptive")
+	}
+	mask := (&Engine{Adaptive: true}).templateMask(y)
+	if mask.Rows != 16 || mask.Cols != 16 {
+		t.Fatalf("mask is %dx%d, want 16x16", mask.Rows, mask.Cols)
+	}
+	if sky, ground := mask.At(2, 5), mask.At(12, 5); sky != jndMinFactor || ground != 1 {
+		t.Errorf("mask %v in the sky, %v on the texture; want %v and 1", sky, ground, jndMinFactor)
+	}
+}
+
+// BenchmarkAdaptive README 中自适应强度一节的表格：512x512 的天空 + 纹理图片，强度 20，冗余嵌入，
+// 误码率为 JPEG q90 之后全部副本的原始误码率
+func BenchmarkAdaptive(b *testing.B) {
+	src := skyOverTexture(512, 512)
+	sky := src.SubImage(image.Rect(0, 0, 512, 256))
+	ground := src.SubImage(image.Rect(0, 256, 512, 512))
+	for _, adaptive := range []bool{false, true} {
+		b.Run(fmt.Sprintf("adaptive=%v", adaptive), func(b *testing.B) {
+			e := &Engine{Strength: 20, Refine: 2, Redundant: true, Adaptive: adaptive}
+			bits := randomBits(e.Capacity(512, 512), 14)
+			var out image.Image
+			for b.Loop() {
+				out = e.Embed(src, bits)
+			}
+			b.ReportMetric(psnr(src, out), "PSNR-dB")
+			b.ReportMetric(psnr(sky, out), "sky-dB")
+			b.ReportMetric(psnr(ground, out), "texture-dB")
+			b.ReportMetric(bitErrorRate(e.ExtractSoft(testimage.JPEGRoundTrip(b, out, 90)), bits)*100, "q90-BER-%")
+		})
+	}
+}
+
+// TestTemplatePSNR 幅度 1 的同步模板单独就让 PSNR 降到约 42 dB；自适应模式在平坦区域减弱模板
+func TestTemplatePSNR(t *testing.T) {
+	src := skyOverTexture(512, 512)
+	fixed := psnr(src, (&Engine{SyncStrength: 1}).Embed(src, nil))
+	adaptive := psnr(src, (&Engine{SyncStrength: 1, Adaptive: true}).Embed(src, nil))
+	if math.Abs(fixed-42) > 0.5 || adaptive < fixed+1 {
+		t.Errorf("template alone: PSNR %.2f dB, %.2f dB adaptive", fixed, adaptive)
+	}
+}
@@ -0,0 +1,150 @@
+package core
+
+import (
+	"crypto/sha256"
+	"image"
+	"math/rand/v2"
+	"slices"
+)
+
+// 密钥模式：
+// 不带密钥时，第 k 个 bit 固定写入按行扫描的第 k 个块，比较候选系数对中的第一对 (默认 [4][3] 与 [3][4])，
+// 任何拿到这个开源库的人都能读出或覆盖水印。
+// 设置 Engine.Key 后，由密钥派生的伪随机序列决定：
+//   1. 块的顺序 (置换)
+//   2. 每个块比较哪一对中频系数，以及两者的先后
+//   3. 每个 bit 写入前异或的白化序列
+//   4. QIM / STDM 的抖动和投影方向 (独立的序列，见 addDither)
+// 没有正确密钥时提取出的只是噪声。
+// 分块模式 (Engine.TileSize) 没有密钥时使用公开的 tileLayoutKey：FindTileOrigin 依靠逐块变化的系数对分辨分块相位，
+// 因此分块模式至少需要两对候选系数。
+//
+// 每块多位 (Engine.BitsPerBlock = n)：每个块依次承载 n 个相邻的 bit，各自使用不同的系数对。
+// 不带密钥时第 i 位使用第 i 对候选；带密钥时从候选中不放回地随机抽取 n 对。
+// 布局完全由 Pairs、BitsPerBlock 和 Key 决定，提取端用同样的设置即可还原，不需要在图片中另外记录。
+// 各对之间不应共用系数，否则写入后一位时会改动前一位
+
+// midBandPairs 各分块边长下候选的中频系数对，每对关于主对角线对称，统计特性相近
+// 16x16 取 8x8 中两倍的频率下标，4x4 取归一化频率相近的位置
+var midBandPairs = map[int][][2][2]int{
+	4: {
+		{{2, 1}, {1, 2}},
+		{{3, 1}, {1, 3}},
+		{{2, 0}, {0, 2}},
+		{{3, 2}, {2, 3}},
+		{{3, 0}, {0, 3}},
+	},
+	8: {
+		{{4, 3}, {3, 4}},
+		{{5, 2}, {2, 5}},
+		{{5, 3}, {3, 5}},
+		{{4, 2}, {2, 4}},
+		{{5, 4}, {4, 5}},
+	},
+	16: {
+		{{8, 6}, {6, 8}},
+		{{10, 4}, {4, 10}},
+		{{10, 6}, {6, 10}},
+		{{8, 4}, {4, 8}},
+		{{10, 8}, {8, 10}},
+	},
+}
+
+// DefaultPairs 分块边长为 blockSize 时默认的候选系数对 (Engine.Pairs 为 nil 时使用)，不支持的边长返回 nil
+func DefaultPairs(blockSize int) [][2][2]int {
+	return slices.Clone(midBandPairs[blockSize])
+}
+
+// pairs 实际使用的候选系数对
+func (e *Engine) pairs() [][2][2]int {
+	if len(e.Pairs) > 0 {
+		return e.Pairs
+	}
+	return midBandPairs[e.blockSize()]
+}
+
+// bitsPerBlock 每个 DCT 块实际写入的 bit 数
+// 受候选系数对的数量限制；STDM 的投影用到全部候选系数，每块只能写 1 位
+func (e *Engine) bitsPerBlock() int {
+	if e.Modulation == ModulationSTDM {
+		return 1
+	}
+	return min(max(e.BitsPerBlock, 1), len(e.pairs()))
+}
+
+// tileLayoutKey 分块模式没有设置密钥时使用的公开密钥
+var tileLayoutKey = []byte("blindwatermark/tile")
+
+// slot 一个 bit 在 DWT 矩阵中的落点
+type slot struct {
+	pos    image.Point // DCT 块左上角 (X 为列, Y 为行)
+	c1, c2 [2]int      // 比较的一对 DCT 系数，c1 > c2 表示 1
+	flip   bool        // 白化位：写入前与数据位异或
+	dither float64     // QIM / STDM 的抖动，以步长为单位，取值 [0, 1)
+	spread uint64      // STDM 投影方向：第 i 位为 1 表示 spreadCoeffs 的第 i 个系数取负号
+}
+
+// slots 按嵌入顺序返回所有落点，同一个块的 bitsPerBlock 个落点相邻
+func (e *Engine) slots(w, h int) []slot {
+	positions := e.blockPositions(w, h)
+	pairs, per := e.pairs(), e.bitsPerBlock()
+	slots := make([]slot, 0, len(positions)*per)
+
+	key := e.Key
+	if len(key) == 0 {
+		if e.tileSize() > 0 {
+			key = tileLayoutKey
+		} else {
+			for _, pos := range positions {
+				for _, pair := range pairs[:per] {
+					slots = append(slots, slot{pos: pos, c1: pair[0], c2: pair[1]})
+				}
+			}
+			e.addDither(slots, key)
+			return slots
+		}
+	}
+
+	seed := sha256.Sum256(append([]byte("blindwatermark/layout:"), key...))
+	rng := rand.New(rand.NewChaCha8(seed))
+	rng.Shuffle(len(positions), func(a, b int) {
+		positions[a], positions[b] = positions[b], positions[a]
+	})
+	order := make([]int, len(pairs))
+	for _, pos := range positions {
+		for i := range order {
+			order[i] = i
+		}
+		for n := range per {
+			// 不放回抽样：从还没用过的候选中选一对
+			r := n + rng.IntN(len(pairs)-n)
+			order[n], order[r] = order[r], order[n]
+			pair := pairs[order[n]]
+			if rng.IntN(2) == 1 {
+				pair[0], pair[1] = pair[1], pair[0]
+			}
+			slots = append(slots, slot{pos: pos, c1: pair[0], c2: pair[1], flip: rng.IntN(2) == 1})
+		}
+	}
+	e.addDither(slots, key)
+	return slots
+}
+
+// addDither QIM / STDM 模式下为各落点生成抖动和投影方向
+// 使用独立的伪随机序列，不影响块顺序和系数对；没有密钥时序列是公开的
+func (e *Engine) addDither(slots []slot, key []byte) {
+	if e.Modulation == ModulationPair {
+		return
+	}
+	seed := sha256.Sum256(append([]byte("blindwatermark/dither:"), key...))
+	rng := rand.New(rand.NewChaCha8(seed))
+	n := len(e.spreadCoeffs())
+	for k := range slots {
+		slots[k].dither = rng.Float64()
+		if n < 64 {
+			slots[k].spread = rng.Uint64N(1 << n)
+		} else {
+			slots[k].spread = rng.Uint64()
+		}
+	}
+}
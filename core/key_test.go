@@ -0,0 +1,78 @@
+package core
+
+import (
+	"blindwatermark/internal/testimage"
+	"image"
+	"math"
+	"testing"
+)
+
+// TestSlotsPermutation 带密钥时块顺序是一个置换：每个块仍然恰好出现 bitsPerBlock 次，同一块内的系数对互不相同
+func TestSlotsPermutation(t *testing.T) {
+	for _, per := range []int{1, 2, 3} {
+		e := &Engine{Key: []byte("k"), BitsPerBlock: per}
+		plain := (&Engine{BitsPerBlock: per}).slots(256, 256)
+		keyed := e.slots(256, 256)
+		if len(keyed) != len(plain) {
+			t.Fatalf("per %d: %d slots with a key, %d without", per, len(keyed), len(plain))
+		}
+		count := map[image.Point]int{}
+		for k := 0; k < len(keyed); k += per {
+			pairs := map[[2]int]bool{}
+			for _, s := range keyed[k : k+per] {
+				if s.pos != keyed[k].pos {
+					t.Fatalf("per %d: slots of one block are not adjacent", per)
+				}
+				for _, c := range [][2]int{s.c1, s.c2} {
+					if pairs[c] {
+						t.Fatalf("per %d: block %v reuses coefficient %v", per, s.pos, c)
+					}
+					pairs[c] = true
+				}
+			}
+			count[keyed[k].pos]++
+		}
+		for _, s := range plain {
+			if count[s.pos] != 1 {
+				t.Fatalf("per %d: block %v used %d times", per, s.pos, count[s.pos])
+			}
+		}
+	}
+}
+
+func TestSlotsDependOnKey(t *testing.T) {
+	a := (&Engine{Key: []byte("alice")}).slots(256, 256)
+	again := (&Engine{Key: []byte("alice")}).slots(256, 256)
+	b := (&Engine{Key: []byte("bob")}).slots(256, 256)
+	same, moved := true, 0
+	for k := range a {
+		if a[k] != again[k] {
+			same = false
+		}
+		if a[k].pos != b[k].pos {
+			moved++
+		}
+	}
+	if !same {
+		t.Error("the layout is not deterministic for the same key")
+	}
+	if moved < len(a)*9/10 {
+		t.Errorf("only %d of %d blocks differ between two keys", moved, len(a))
+	}
+}
+
+// TestWrongKey 正确的密钥无误码；错误的密钥或不带密钥读出的误码率接近 0.5
+func TestWrongKey(t *testing.T) {
+	e := &Engine{Strength: 20, Key: []byte("alice")}
+	bits := randomBits(e.Capacity(512, 384), 5)
+	marked := e.Embed(testimage.Photo(t, 512, 384), bits)
+	if ber := bitErrorRate(e.ExtractSoft(marked), bits); ber != 0 {
+		t.Errorf("right key: BER %.4f", ber)
+	}
+	for _, key := range [][]byte{[]byte("bob"), nil} {
+		other := &Engine{Strength: 20, Key: key}
+		if ber := bitErrorRate(other.ExtractSoft(marked), bits); math.Abs(ber-0.5) > 0.05 {
+			t.Errorf("key %q: BER %.4f, want about 0.5", key, ber)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package core
+
+// Matrix 行优先存储的二维矩阵，所有元素位于同一个底层数组中
+// (i, j) 位于 Data[i*Stride+j]。View 返回共享底层数组的子矩阵 (子带、块)，
+// 因此多级 DWT 可以直接在左上角的 LL 视图上原地进行，无需复制
+type Matrix struct {
+	Rows, Cols int
+	Stride     int
+	Data       []float64
+}
+
+// NewMatrix 创建 rows x cols 的零矩阵
+func NewMatrix(rows, cols int) *Matrix {
+	return &Matrix{Rows: rows, Cols: cols, Stride: cols, Data: make([]float64, rows*cols)}
+}
+
+// MatrixFromRows 把 [][]float64 复制为 Matrix
+func MatrixFromRows(rows [][]float64) *Matrix {
+	if len(rows) == 0 {
+		return NewMatrix(0, 0)
+	}
+	m := NewMatrix(len(rows), len(rows[0]))
+	for i, row := range rows {
+		copy(m.Row(i), row)
+	}
+	return m
+}
+
+func (m *Matrix) At(i, j int) float64 { return m.Data[i*m.Stride+j] }
+
+func (m *Matrix) Set(i, j int, v float64) { m.Data[i*m.Stride+j] = v }
+
+// Row 返回第 i 行，与矩阵共享底层数组
+func (m *Matrix) Row(i int) []float64 {
+	return m.Data[i*m.Stride : i*m.Stride+m.Cols]
+}
+
+// View 返回以 (i, j) 为左上角、rows x cols 的子矩阵，与 m 共享底层数组
+func (m *Matrix) View(i, j, rows, cols int) *Matrix {
+	start := i*m.Stride + j
+	end := start
+	if rows > 0 && cols > 0 {
+		end = start + (rows-1)*m.Stride + cols
+	}
+	return &Matrix{Rows: rows, Cols: cols, Stride: m.Stride, Data: m.Data[start:end]}
+}
+
+// Clone 复制为一个紧凑存储 (Stride == Cols) 的新矩阵
+func (m *Matrix) Clone() *Matrix {
+	c := NewMatrix(m.Rows, m.Cols)
+	for i := 0; i < m.Rows; i++ {
+		copy(c.Row(i), m.Row(i))
+	}
+	return c
+}
+
+// Slices 以 [][]float64 的形式访问矩阵，各行与矩阵共享底层数组 (不复制数据)
+func (m *Matrix) Slices() [][]float64 {
+	rows := make([][]float64, m.Rows)
+	for i := range rows {
+		rows[i] = m.Row(i)
+	}
+	return rows
+}
+
+// column 把第 j 列读入 dst
+func (m *Matrix) column(j int, dst []float64) {
+	for i := range dst {
+		dst[i] = m.Data[i*m.Stride+j]
+	}
+}
+
+// setColumn 把 src 写入第 j 列
+func (m *Matrix) setColumn(j int, src []float64) {
+	for i, v := range src {
+		m.Data[i*m.Stride+j] = v
+	}
+}
+
+// block 把以 (i, j) 为左上角的 n x n 块读入 dst
+func (m *Matrix) block(i, j, n int, dst []float64) {
+	for bi := 0; bi < n; bi++ {
+		copy(dst[bi*n:bi*n+n], m.Data[(i+bi)*m.Stride+j:])
+	}
+}
+
+// setBlock 把 src 写回以 (i, j) 为左上角的 n x n 块
+func (m *Matrix) setBlock(i, j, n int, src []float64) {
+	for bi := 0; bi < n; bi++ {
+		copy(m.Data[(i+bi)*m.Stride+j:(i+bi)*m.Stride+j+n], src[bi*n:bi*n+n])
+	}
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"blindwatermark/internal/testimage"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+func randomMatrix(rows, cols int, seed uint64) *Matrix {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	m := NewMatrix(rows, cols)
+	for i := range m.Data {
+		m.Data[i] = rng.Float64() * 255
+	}
+	return m
+}
+
+func TestMatrixView(t *testing.T) {
+	m := randomMatrix(6, 8, 1)
+	v := m.View(2, 3, 3, 4)
+	if v.At(1, 2) != m.At(3, 5) {
+		t.Fatalf("View(2, 3).At(1, 2) = %v, want %v", v.At(1, 2), m.At(3, 5))
+	}
+	v.Set(1, 2, -1)
+	if m.At(3, 5) != -1 {
+		t.Error("writing through a view did not change the matrix")
+	}
+	if got := len(v.Row(2)); got != 4 {
+		t.Errorf("view row has %d elements, want 4", got)
+	}
+
+	c := v.Clone()
+	if c.Stride != c.Cols || c.At(1, 2) != -1 {
+		t.Fatalf("Clone: stride %d, At(1, 2) = %v", c.Stride, c.At(1, 2))
+	}
+	c.Set(0, 0, 42)
+	if m.At(2, 3) == 42 {
+		t.Error("Clone shares data with the matrix")
+	}
+
+	rows := m.Slices()
+	rows[4][7] = 7
+	if m.At(4, 7) != 7 {
+		t.Error("Slices copied the data")
+	}
+	if back := MatrixFromRows(rows); back.At(4, 7) != 7 || back.Rows != 6 || back.Cols != 8 {
+		t.Error("MatrixFromRows did not copy the rows")
+	}
+}
+
+func TestMatrixBlock(t *testing.T) {
+	m := randomMatrix(32, 40, 2)
+	block := make([]float64, 64)
+	m.block(8, 16, 8, block)
+	for bi := 0; bi < 8; bi++ {
+		for bj := 0; bj < 8; bj++ {
+			if block[bi*8+bj] != m.At(8+bi, 16+bj) {
+				t.Fatalf("block[%d][%d] differs from the matrix", bi, bj)
+			}
+			block[bi*8+bj] = float64(bi*8 + bj)
+		}
+	}
+	m.setBlock(8, 16, 8, block)
+	if m.At(15, 23) != 63 || m.At(8, 24) == 0 {
+		t.Error("setBlock wrote outside the block or not at all")
+	}
+}
+
+// TestDWTInPlace 原地的多级分解与逐级对 LL 调用 DWT2D 的结果一致，且逆变换还原输入
+func TestDWTInPlace(t *testing.T) {
+	for levels := 1; levels <= 3; levels++ {
+		src := randomMatrix(64, 48, uint64(levels))
+
+		want := src.Clone()
+		for l := 0; l < levels; l++ {
+			ll := want.View(0, 0, want.Rows>>l, want.Cols>>l)
+			out := DWT2D(ll.Slices())
+			for i := range out {
+				copy(ll.Row(i), out[i])
+			}
+		}
+
+		got := src.Clone()
+		DWT2DInPlace(got, levels, nil)
+		for i := range got.Data {
+			if math.Abs(got.Data[i]-want.Data[i]) > 1e-9 {
+				t.Fatalf("levels %d: coefficient %d is %v, want %v", levels, i, got.Data[i], want.Data[i])
+			}
+		}
+
+		IDWT2DInPlace(got, levels, nil)
+		for i := range got.Data {
+			if math.Abs(got.Data[i]-src.Data[i]) > 1e-6 {
+				t.Fatalf("levels %d: sample %d is %v after the inverse, want %v", levels, i, got.Data[i], src.Data[i])
+			}
+		}
+	}
+}
+
+// BenchmarkEmbed24MP 2400 万像素 (6000x4000) 的图片整图嵌入的耗时和内存分配
+// 输出的 RGBA 图片占 96 MB，亮度矩阵每份 192 MB；每轮 Refine 要重新提取并补嵌，各需一份矩阵
+func BenchmarkEmbed24MP(b *testing.B) {
+	photo := testimage.Photo(b, 1500, 1000)
+	src := image.NewRGBA(image.Rect(0, 0, 6000, 4000))
+	for y := 0; y < 4000; y += 1000 {
+		for x := 0; x < 6000; x += 1500 {
+			draw.Draw(src, image.Rect(x, y, x+1500, y+1000), photo, image.Point{}, draw.Src)
+		}
+	}
+	for _, refine := range []int{0, 2} {
+		b.Run(fmt.Sprintf("refine=%d", refine), func(b *testing.B) {
+			e := &Engine{Strength: 20, Refine: refine}
+			bits := randomBits(e.Capacity(6000, 4000), 1)
+			b.ReportAllocs()
+			for b.Loop() {
+				e.Embed(src, bits)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package core
+
+import (
+	"math"
+	"slices"
+)
+
+// 调制方式：
+// 默认的系数对模式比较两个中频系数的大小，差值的符号表示 bit，嵌入时把差值拉开到 Strength 以上。
+// QIM (量化索引调制，这里是抖动调制 DM) 把同一对系数的差值量化到步长为 Step 的格点上，
+// bit 为 0 和 1 的格点互相错开半个步长，提取时看差值离哪一组格点更近。
+// 失真和抗噪能力都只由步长决定，与原图内容无关，可以按 JPEG 质量选定步长 (见 StepForQuality)。
+// STDM (扩展变换抖动调制) 把全部候选系数 (默认十个中频系数) 在随机 ±1 方向上的投影量化到格点上，
+// 压缩噪声在投影方向上被平均掉一部分，同样的失真下更抗 JPEG。
+// 两者的软判决值由离格点的距离换算：正好落在格点上时为 ±1，落在两组格点正中时为 0。
+// 抖动和投影方向由密钥派生 (没有密钥时是公开的)，见 addDither
+
+// Modulation 一个 bit 写入 DCT 块的方式
+type Modulation int
+
+const (
+	ModulationPair Modulation = iota // 系数对：拉开两个中频系数的差值 (默认)
+	ModulationQIM                    // 抖动调制：量化系数对的差值
+	ModulationSTDM                   // 扩展变换抖动调制：量化全部候选系数的投影
+)
+
+// spreadCoeffs STDM 投影使用的系数：候选系数对中的全部系数
+func (e *Engine) spreadCoeffs() [][2]int {
+	if len(e.Pairs) == 0 {
+		return midBandCoeffs[e.blockSize()]
+	}
+	return uniqueCoeffs(e.Pairs)
+}
+
+// midBandCoeffs 各分块边长下 midBandPairs 中的全部系数
+var midBandCoeffs = func() map[int][][2]int {
+	coeffs := make(map[int][][2]int)
+	for n, pairs := range midBandPairs {
+		coeffs[n] = uniqueCoeffs(pairs)
+	}
+	return coeffs
+}()
+
+// uniqueCoeffs 系数对中出现的系数，按出现顺序去重
+func uniqueCoeffs(pairs [][2][2]int) [][2]int {
+	var coeffs [][2]int
+	for _, pair := range pairs {
+		for _, c := range pair {
+			if !slices.Contains(coeffs, c) {
+				coeffs = append(coeffs, c)
+			}
+		}
+	}
+	return coeffs
+}
+
+// step QIM / STDM 的量化步长，未设置 Step 时按 JPEG 质量 75 选择
+func (e *Engine) step() float64 {
+	if e.Step > 0 {
+		return e.Step
+	}
+	return e.StepForQuality(75)
+}
+
+// modulate 把 bit 写入做过 DCT 的块，strength 为系数对模式下差值的下限，QIM / STDM 下为步长
+func (e *Engine) modulate(block []float64, sl slot, bit bool, strength float64) {
+	n := e.blockSize()
+	c1, c2 := sl.c1[0]*n+sl.c1[1], sl.c2[0]*n+sl.c2[1]
+	switch e.Modulation {
+	case ModulationQIM:
+		d := block[c1] - block[c2]
+		delta := quantize(d, strength, sl.dither, bit) - d
+		block[c1] += delta / 2
+		block[c2] -= delta / 2
+
+	case ModulationSTDM:
+		coeffs := e.spreadCoeffs()
+		p := project(block, n, coeffs, sl.spread)
+		delta := quantize(p, strength, sl.dither, bit) - p
+		for i, c := range coeffs {
+			block[c[0]*n+c[1]] += delta * spreadSign(sl.spread, i) / math.Sqrt(float64(len(coeffs)))
+		}
+
+	default:
+		// 默认 v1 = [4][3], v2 = [3][4]
+		v1 := block[c1]
+		v2 := block[c2]
+
+		if bit {
+			if v1-v2 < strength {
+				diff := (strength - (v1 - v2)) / 2.0
+				v1 += diff
+				v2 -= diff
+			}
+		} else {
+			if v2-v1 < strength {
+				diff := (strength - (v2 - v1)) / 2.0
+				v2 += diff
+				v1 -= diff
+			}
+		}
+		block[c1] = v1
+		block[c2] = v2
+	}
+}
+
+// demodulate 做过 DCT 的块的软判决值 (尚未去掉白化)，参数同 modulate
+func (e *Engine) demodulate(block []float64, sl slot, strength float64) float64 {
+	n := e.blockSize()
+	c1, c2 := sl.c1[0]*n+sl.c1[1], sl.c2[0]*n+sl.c2[1]
+	switch e.Modulation {
+	case ModulationQIM:
+		return quantizedSoft(block[c1]-block[c2], strength, sl.dither)
+	case ModulationSTDM:
+		return quantizedSoft(project(block, n, e.spreadCoeffs(), sl.spread), strength, sl.dither)
+	}
+	return (block[c1] - block[c2]) / strength
+}
+
+// quantize 把 v 量化到 bit 对应的格点：bit 为 0 时为 (k + dither) * step，为 1 时再错开半个步长
+func quantize(v, step, dither float64, bit bool) float64 {
+	if bit {
+		dither += 0.5
+	}
+	return (math.Round(v/step-dither) + dither) * step
+}
+
+// quantizedSoft v 的软判决值：离 1 的格点越近越接近 1，离 0 的格点越近越接近 -1，两者之间线性过渡
+func quantizedSoft(v, step, dither float64) float64 {
+	phase := v/step - dither
+	phase -= math.Floor(phase)
+	return 4*min(phase, 1-phase) - 1
+}
+
+// project n x n 块中系数 coeffs 在 spread 方向上的投影 (单位向量)
+func project(block []float64, n int, coeffs [][2]int, spread uint64) float64 {
+	var p float64
+	for i, c := range coeffs {
+		p += block[c[0]*n+c[1]] * spreadSign(spread, i)
+	}
+	return p / math.Sqrt(float64(len(coeffs)))
+}
+
+// spreadSign 投影方向的第 i 个分量的符号
+func spreadSign(spread uint64, i int) float64 {
+	if spread>>i&1 == 1 {
+		return -1
+	}
+	return 1
+}
+
+// StepForQuality 使嵌入的数据在质量不低于 quality 的 JPEG 压缩后仍能正确提取的量化步长
+// 按当前的调制方式和 DWT 级数换算，quality 取值 1-100。
+// JPEG 的量化误差与量化表的缩放比例 (libjpeg 的公式，质量 50 时为 100) 大致成正比，
+// 步长取 a + b * 缩放比例：a 保证像素取整后数据仍然存在，b 在若干照片上按 4:2:0、Go 标准库编码器标定，
+// 最后乘以 1.2 留出余量。2 级以上分解的子带更靠近低频，受量化的影响更小，沿用 2 级的 b (偏保守)，
+// 但每级的像素改动更分散，更容易被取整抹掉，a 随级数增大。
+// 系数对模式没有步长，返回 0
+func (e *Engine) StepForQuality(quality int) float64 {
+	quality = min(max(quality, 1), 100)
+	scale := 200 - 2*float64(quality)
+	if quality < 50 {
+		scale = 5000 / float64(quality)
+	}
+
+	var a, b float64
+	switch {
+	case e.Modulation == ModulationQIM && e.levels() == 1:
+		a, b = 40, 4
+	case e.Modulation == ModulationQIM:
+		a, b = 40, 1.6
+	case e.Modulation == ModulationSTDM && e.levels() == 1:
+		a, b = 40, 3
+	case e.Modulation == ModulationSTDM:
+		a, b = 40, 0.8
+	default:
+		return 0
+	}
+	a *= max(float64(e.levels())/2, 1)
+	return 1.2 * (a + b*scale)
+}
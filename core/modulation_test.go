@@ -0,0 +1,137 @@
+package core
+
+import (
+	"blindwatermark/internal/testimage"
+	"fmt"
+	"image"
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestQuantize(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 1))
+	for range 1000 {
+		v, step, dither := rng.NormFloat64()*500, 10+rng.Float64()*100, rng.Float64()
+		for _, bit := range []bool{false, true} {
+			q := quantize(v, step, dither, bit)
+			if math.Abs(q-v) > step/2+1e-9 {
+				t.Fatalf("quantize(%v, %v, %v, %v) = %v, moved more than half a step", v, step, dither, bit, q)
+			}
+			want := -1.0
+			if bit {
+				want = 1
+			}
+			if s := quantizedSoft(q, step, dither); math.Abs(s-want) > 1e-9 {
+				t.Fatalf("soft value on a %v lattice point is %v", bit, s)
+			}
+			// 两组格点正中
+			if s := quantizedSoft(q+step/4, step, dither); math.Abs(s) > 1e-9 {
+				t.Fatalf("soft value between the lattices is %v", s)
+			}
+		}
+	}
+}
+
+// TestProject 投影方向是单位向量：沿投影方向改动 delta，投影正好改变 delta
+func TestProject(t *testing.T) {
+	e := &Engine{}
+	coeffs := e.spreadCoeffs()
+	if len(coeffs) != 10 {
+		t.Fatalf("%d spread coefficients, want 10", len(coeffs))
+	}
+	block := make([]float64, 64)
+	for i := range block {
+		block[i] = float64(i * 7 % 13)
+	}
+	const spread = 0b1011001101
+	before := project(block, 8, coeffs, spread)
+	for i, c := range coeffs {
+		block[c[0]*8+c[1]] += 3 * spreadSign(spread, i) / math.Sqrt(float64(len(coeffs)))
+	}
+	if d := project(block, 8, coeffs, spread) - before; math.Abs(d-3) > 1e-9 {
+		t.Errorf("projection moved by %v, want 3", d)
+	}
+}
+
+func TestStepForQuality(t *testing.T) {
+	if s := (&Engine{}).StepForQuality(75); s != 0 {
+		t.Errorf("pair modulation: step %v, want 0", s)
+	}
+	for _, e := range []*Engine{
+		{Modulation: ModulationQIM}, {Modulation: ModulationQIM, Levels: 2},
+		{Modulation: ModulationSTDM}, {Modulation: ModulationSTDM, Levels: 2},
+	} {
+		prev := math.Inf(1)
+		for _, q := range []int{10, 50, 75, 90, 100} {
+			s := e.StepForQuality(q)
+			if s <= 0 || s >= prev {
+				t.Errorf("%v, levels %d: step %v at quality %d, previous %v", e.Modulation, e.Levels, s, q, prev)
+			}
+			prev = s
+		}
+		if e.step() != e.StepForQuality(75) {
+			t.Errorf("%v: default step is not StepForQuality(75)", e.Modulation)
+		}
+	}
+}
+
+// TestModulationJPEG 按 StepForQuality(75) 选定的步长在质量 75 的 JPEG 之后仍能无误提取
+func TestModulationJPEG(t *testing.T) {
+	src := testimage.Photo(t, 512, 512)
+	for _, m := range []Modulation{ModulationQIM, ModulationSTDM} {
+		e := &Engine{Levels: 2, Refine: 2, Modulation: m, Key: []byte("k")}
+		bits := randomBits(e.Capacity(512, 512), 15)
+		out := e.Embed(src, bits)
+		soft := e.ExtractSoft(out)
+		if ber := bitErrorRate(soft, bits); ber != 0 {
+			t.Errorf("%v: BER %.4f on an untouched image", m, ber)
+		}
+		if ber := bitErrorRate(e.ExtractSoft(testimage.JPEGRoundTrip(t, out, 75)), bits); ber > 0.005 {
+			t.Errorf("%v: BER %.4f after JPEG q75", m, ber)
+		}
+		// 抖动由密钥派生，换一个密钥读出的是噪声
+		wrong := *e
+		wrong.Key = []byte("other")
+		if ber := bitErrorRate(wrong.ExtractSoft(out), bits); ber < 0.4 {
+			t.Errorf("%v: BER %.4f with the wrong key", m, ber)
+		}
+	}
+}
+
+// BenchmarkModulation README 中调制方式一节的表格：三张图片上 StepForQuality(75) 的 PSNR 和 JPEG q75 误码率
+func BenchmarkModulation(b *testing.B) {
+	images := []struct {
+		name string
+		img  image.Image
+	}{
+		{"photo512", testimage.Photo(b, 512, 512)},
+		{"photo1280", testimage.Photo(b, 1280, 800)},
+		{"synth512", synthPhoto(512, 512, 128, 30, 1)},
+	}
+	for _, c := range []struct {
+		name   string
+		engine Engine
+	}{
+		{"pair/L2", Engine{Strength: 20, Levels: 2, Refine: 2}},
+		{"qim/L1", Engine{Levels: 1, Refine: 2, Modulation: ModulationQIM}},
+		{"qim/L2", Engine{Levels: 2, Refine: 2, Modulation: ModulationQIM}},
+		{"stdm/L1", Engine{Levels: 1, Refine: 2, Modulation: ModulationSTDM}},
+		{"stdm/L2", Engine{Levels: 2, Refine: 2, Modulation: ModulationSTDM}},
+	} {
+		for _, im := range images {
+			b.Run(fmt.Sprintf("%s/%s", c.name, im.name), func(b *testing.B) {
+				e := c.engine
+				w, h := im.img.Bounds().Dx(), im.img.Bounds().Dy()
+				bits := randomBits(e.Capacity(w, h), 16)
+				var out image.Image
+				for b.Loop() {
+					out = e.Embed(im.img, bits)
+				}
+				b.ReportMetric(e.step(), "step")
+				b.ReportMetric(psnr(im.img, out), "PSNR-dB")
+				b.ReportMetric(bitErrorRate(e.ExtractSoft(testimage.JPEGRoundTrip(b, out, 75)), bits)*100, "q75-BER-%")
+			})
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"blindwatermark/internal/testimage"
+	"fmt"
+	"testing"
+)
+
+func TestBitsPerBlock(t *testing.T) {
+	custom := [][2][2]int{{{1, 2}, {2, 1}}, {{3, 1}, {1, 3}}, {{4, 3}, {3, 4}}}
+	for _, c := range []struct {
+		e    Engine
+		want int
+	}{
+		{Engine{}, 1},
+		{Engine{BitsPerBlock: 3}, 3},
+		{Engine{BitsPerBlock: 9}, 5}, // 默认 5 对候选
+		{Engine{BitsPerBlock: 9, Pairs: custom}, 3},
+		{Engine{BitsPerBlock: 3, Modulation: ModulationSTDM}, 1},
+	} {
+		if got := c.e.bitsPerBlock(); got != c.want {
+			t.Errorf("BitsPerBlock %d, %d pairs, %v: %d bits per block, want %d",
+				c.e.BitsPerBlock, len(c.e.pairs()), c.e.Modulation, got, c.want)
+		}
+		if got, one := c.e.Capacity(512, 384), (&Engine{}).Capacity(512, 384); got != one*c.want {
+			t.Errorf("BitsPerBlock %d: capacity %d, want %d", c.e.BitsPerBlock, got, one*c.want)
+		}
+	}
+}
+
+// TestPairsLayout 没有密钥时第 i 位使用第 i 对候选
+func TestPairsLayout(t *testing.T) {
+	custom := [][2][2]int{{{1, 2}, {2, 1}}, {{3, 1}, {1, 3}}, {{4, 3}, {3, 4}}}
+	e := &Engine{Pairs: custom, BitsPerBlock: 2}
+	for k, sl := range e.slots(256, 256) {
+		if want := custom[k%2]; sl.c1 != want[0] || sl.c2 != want[1] {
+			t.Fatalf("slot %d uses %v/%v, want %v", k, sl.c1, sl.c2, want)
+		}
+	}
+}
+
+// TestBitsPerBlockEmbed 每块多位时各位互不干扰，带不带密钥、自定义系数对都能无误提取
+func TestBitsPerBlockEmbed(t *testing.T) {
+	src := testimage.Photo(t, 512, 384)
+	for _, e := range []*Engine{
+		{Strength: 20, BitsPerBlock: 2},
+		{Strength: 20, BitsPerBlock: 3, Key: []byte("k")},
+		{Strength: 20, BitsPerBlock: 2, Refine: 2, Pairs: [][2][2]int{{{1, 2}, {2, 1}}, {{3, 1}, {1, 3}}, {{4, 3}, {3, 4}}, {{2, 3}, {3, 2}}}},
+		{BitsPerBlock: 2, Modulation: ModulationQIM, Levels: 2},
+	} {
+		bits := randomBits(e.Capacity(512, 384), 17)
+		if ber := bitErrorRate(e.ExtractSoft(e.Embed(src, bits)), bits); ber != 0 {
+			t.Errorf("%d bits per block, key %q, %d pairs: BER %.4f", e.BitsPerBlock, e.Key, len(e.pairs()), ber)
+		}
+	}
+}
+
+// BenchmarkBitsPerBlock README 中每块多位一节的 PSNR：1531x1014 的示例照片，强度 20，校验 2 轮，容量写满
+func BenchmarkBitsPerBlock(b *testing.B) {
+	src := testimage.Photo(b, 1531, 1014)
+	for _, per := range []int{1, 2, 3} {
+		b.Run(fmt.Sprintf("bits=%d", per), func(b *testing.B) {
+			e := &Engine{Strength: 20, Refine: 2, BitsPerBlock: per}
+			bits := randomBits(e.Capacity(1531, 1014), 18)
+			var p float64
+			for b.Loop() {
+				p = psnr(src, e.Embed(src, bits))
+			}
+			b.ReportMetric(float64(len(bits)), "bits")
+			b.ReportMetric(p, "PSNR-dB")
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package core
+
+import (
+	"runtime"
+	"sync"
+)
+
+// workers 实际使用的并发数
+func (e *Engine) workers() int {
+	if e.Workers <= 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return e.Workers
+}
+
+// parallelFor 把 [0, n) 切成 workers 段连续区间，各用一个 goroutine 执行 fn(lo, hi)
+// 各段写入互不重叠的数据，结果与串行执行逐位相同；workers <= 1 时直接在当前 goroutine 执行
+func parallelFor(workers, n int, fn func(lo, hi int)) {
+	workers = min(workers, n)
+	if workers <= 1 {
+		fn(0, n)
+		return
+	}
+	var wg sync.WaitGroup
+	chunk := (n + workers - 1) / workers
+	for lo := 0; lo < n; lo += chunk {
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			fn(lo, hi)
+		}(lo, min(lo+chunk, n))
+	}
+	wg.Wait()
+}
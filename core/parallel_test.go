@@ -0,0 +1,71 @@
+package core
+
+import (
+	"blindwatermark/internal/testimage"
+	"bytes"
+	"fmt"
+	"image"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+// TestWorkersDeterministic 输出的像素和提取的软判决值与并发数无关，逐位相同
+func TestWorkersDeterministic(t *testing.T) {
+	src := testimage.Photo(t, 640, 480)
+	for _, base := range []Engine{
+		{Strength: 20, Refine: 2},
+		{Strength: 20, SyncStrength: 1, Levels: 2, Key: []byte("k"), BitsPerBlock: 2},
+		{Strength: 20, Adaptive: true, Chroma: ChannelCb | ChannelCr, Subbands: SubbandHL | SubbandLH},
+		{Strength: 20, TileSize: 256, Modulation: ModulationSTDM},
+	} {
+		bits := randomBits(base.Capacity(640, 480), 8)
+		var wantPix []byte
+		var wantSoft []float64
+		for _, workers := range []int{1, 2, 3, runtime.GOMAXPROCS(0)} {
+			e := base
+			e.Workers = workers
+			out := e.Embed(src, bits).(*image.RGBA)
+			soft := e.ExtractSoft(out)
+			if wantPix == nil {
+				wantPix, wantSoft = out.Pix, soft
+				continue
+			}
+			if !bytes.Equal(out.Pix, wantPix) {
+				t.Errorf("%+v: output with %d workers differs from the serial one", base, workers)
+			}
+			if !slices.Equal(soft, wantSoft) {
+				t.Errorf("%+v: soft values with %d workers differ from the serial ones", base, workers)
+			}
+		}
+	}
+}
+
+// BenchmarkEmbed 1531x1014 的示例照片，串行与默认并发数的嵌入耗时和内存分配
+func BenchmarkEmbed(b *testing.B) {
+	src := testimage.Photo(b, 1531, 1014)
+	for _, workers := range []int{1, 0} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			e := &Engine{Strength: 20, Refine: 2, Workers: workers}
+			bits := randomBits(e.Capacity(1531, 1014), 1)
+			b.ReportAllocs()
+			for b.Loop() {
+				e.Embed(src, bits)
+			}
+		})
+	}
+}
+
+func BenchmarkExtract(b *testing.B) {
+	e := &Engine{Strength: 20, Refine: 2}
+	marked := e.Embed(testimage.Photo(b, 1531, 1014), randomBits(e.Capacity(1531, 1014), 1))
+	for _, workers := range []int{1, 0} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			e := &Engine{Strength: 20, Workers: workers}
+			b.ReportAllocs()
+			for b.Loop() {
+				e.ExtractSoft(marked)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package core
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// 输出图片保持源图的像素格式：Gray、Gray16、NRGBA、NRGBA64、RGBA64、YCbCr 原样对应，
+// 其余 (RGBA、Paletted 等) 输出 RGBA。alpha 原样保留。
+// 亮度和变化量都在非预乘的颜色上计算，取值为 0-255 的浮点数，16 位图片的低 8 位不会被截断。
+//
+// YCbCr (JPEG 解码的结果) 直接读写 Y 平面，Cb / Cr 平面原样复制 (色度通道承载数据时除外，见 chroma.go)，
+// 不经过 RGB，没有任何换算误差。
+// 其余格式把 Y 的变化量加到 R、G、B 上：三者加同样的量时 Cb / Cr 不变，等价于只改 Y；
+// 某个分量超出 [0, 255] 被截断时，差额转给其余未饱和的分量 (见 shiftLuma)，
+// 否则高光和暗部的 Y 达不到目标值，嵌入的系数差被削弱，JPEG 之后误码明显增多
+
+// newOutput 创建与 src 像素格式对应、范围为 r 的输出图片
+// YCbCr 的输出已经带有 src 中对应区域的全部像素，其他格式的输出为空白。
+// 色度通道承载数据时 (见 chroma.go) YCbCr 输出为 4:4:4，每个像素的色度都可以单独修改
+func (e *Engine) newOutput(src image.Image, r image.Rectangle) image.Image {
+	switch s := src.(type) {
+	case *image.YCbCr:
+		if out := newYCbCrOutput(s, r, e.Chroma != 0); out != nil {
+			return out
+		}
+	case *image.Gray:
+		return image.NewGray(r)
+	case *image.Gray16:
+		return image.NewGray16(r)
+	case *image.NRGBA:
+		return image.NewNRGBA(r)
+	case *image.NRGBA64:
+		return image.NewNRGBA64(r)
+	case *image.RGBA64:
+		return image.NewRGBA64(r)
+	}
+	return image.NewRGBA(r)
+}
+
+// newYCbCrOutput 复制 src 中以其左上角为原点的区域 r
+// full 为 true 时输出 4:4:4 (色度按最近的采样点展开)，否则保持 src 的色度采样方式；
+// 后者要求左上角在色度采样网格上，奇数坐标的 SubImage 等无法在以 (0, 0) 为原点的输出中对齐，返回 nil
+func newYCbCrOutput(src *image.YCbCr, r image.Rectangle, full bool) *image.YCbCr {
+	origin := src.Rect.Min
+	if full {
+		out := image.NewYCbCr(r, image.YCbCrSubsampleRatio444)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				so, do := src.COffset(x+origin.X, y+origin.Y), out.COffset(x, y)
+				out.Y[do] = src.Y[src.YOffset(x+origin.X, y+origin.Y)]
+				out.Cb[do], out.Cr[do] = src.Cb[so], src.Cr[so]
+			}
+		}
+		return out
+	}
+
+	hs, vs := chromaFactors(src.SubsampleRatio)
+	if origin.X%hs != 0 || origin.Y%vs != 0 {
+		return nil
+	}
+	out := image.NewYCbCr(r, src.SubsampleRatio)
+	if r.Empty() {
+		return out
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		sx, sy := r.Min.X+origin.X, y+origin.Y
+		copy(out.Y[out.YOffset(r.Min.X, y):][:r.Dx()], src.Y[src.YOffset(sx, sy):])
+		// 一行像素对应的色度样本数，垂直方向共用一行色度时重复复制，结果相同
+		lo, hi := out.COffset(r.Min.X, y), out.COffset(r.Max.X-1, y)+1
+		copy(out.Cb[lo:hi], src.Cb[src.COffset(sx, sy):])
+		copy(out.Cr[lo:hi], src.Cr[src.COffset(sx, sy):])
+	}
+	return out
+}
+
+// chromaFactors 色度采样在水平、垂直方向上的间隔 (像素)
+func chromaFactors(ratio image.YCbCrSubsampleRatio) (h, v int) {
+	switch ratio {
+	case image.YCbCrSubsampleRatio422:
+		return 2, 1
+	case image.YCbCrSubsampleRatio420:
+		return 2, 2
+	case image.YCbCrSubsampleRatio440:
+		return 1, 2
+	case image.YCbCrSubsampleRatio411:
+		return 4, 1
+	case image.YCbCrSubsampleRatio410:
+		return 4, 2
+	}
+	return 1, 1
+}
+
+// pixelSetter 返回把输出图片 out 中 (x, y) 处像素的 Y、Cb、Cr 改为 y、cb、cr 的函数，(sx, sy) 为源图 src 中对应的像素
+// 某个通道为 keep 时保持不变。YCbCr 输出直接写平面，其他格式先改色度再改亮度，亮度优先达到目标
+func pixelSetter(out, src image.Image) func(x, y, sx, sy int, yv, cb, cr float64) {
+	if o, ok := out.(*image.YCbCr); ok {
+		return func(x, y, _, _ int, yv, cb, cr float64) {
+			if !math.IsNaN(yv) {
+				o.Y[o.YOffset(x, y)] = clamp(yv)
+			}
+			if !math.IsNaN(cb) {
+				o.Cb[o.COffset(x, y)] = clamp(cb)
+			}
+			if !math.IsNaN(cr) {
+				o.Cr[o.COffset(x, y)] = clamp(cr)
+			}
+		}
+	}
+	dst := out.(draw.Image)
+	read := pixelReader(src)
+	// 补嵌时原地改写 (out 即 src)，只有补嵌过的块附近的像素会变，其余像素经 DWT 再 IDWT 只有 1e-10 量级的误差，
+	// 跳过它们省掉大部分截断补偿和写入。输出图片都由 newOutput 创建，是指针，比较不会 panic
+	inPlace := out == src
+	return func(x, y, sx, sy int, yv, cb, cr float64) {
+		r, g, b, a := read(sx, sy)
+		oldY := 0.299*r + 0.587*g + 0.114*b
+		if math.IsNaN(yv) {
+			yv = oldY
+		}
+		var dcb, dcr float64
+		if !math.IsNaN(cb) || !math.IsNaN(cr) {
+			oldCb, oldCr := rgbToChroma(r, g, b)
+			if !math.IsNaN(cb) {
+				dcb = cb - oldCb
+			}
+			if !math.IsNaN(cr) {
+				dcr = cr - oldCr
+			}
+		}
+		if inPlace && math.Abs(yv-oldY) < unchanged && math.Abs(dcb) < unchanged && math.Abs(dcr) < unchanged {
+			return
+		}
+		if dcb != 0 || dcr != 0 {
+			r, g, b = shiftChroma(r, g, b, dcb, dcr)
+		}
+		r, g, b = shiftLuma(r, g, b, yv-(0.299*r+0.587*g+0.114*b))
+		writePixel(dst, x, y, r, g, b, a)
+	}
+}
+
+// unchanged 原地改写时小于它的变化量视为没有变化，远小于 16 位像素的一个灰阶 (1/257)
+const unchanged = 1e-6
+
+// shiftLuma 把颜色 (r, g, b) 的 Y 增加 d，尽量不改变色度
+// 先给三个分量加上 d，超出 [0, 255] 的分量截断后，Y 的差额按亮度权重分给仍有余量的分量，
+// 重复到达到目标为止 (至多三轮，每轮至少多一个分量饱和)。只有被截断的像素色度略有偏移；
+// 每轮给单个分量的补偿不超过 2|d|，免得权重最小的 B 把差额放大成明显的色偏。
+// 三个分量都饱和时 (纯白、纯黑) 目标本身超出范围，只能做到截断为止
+func shiftLuma(r, g, b, d float64) (float64, float64, float64) {
+	c := [3]float64{r + d, g + d, b + d}
+	weight := [3]float64{0.299, 0.587, 0.114}
+	target := 0.299*r + 0.587*g + 0.114*b + d
+	for range 3 {
+		var y, free float64
+		for k := range c {
+			c[k] = min(max(c[k], 0), 255)
+			y += weight[k] * c[k]
+		}
+		residual := target - y
+		for k := range c {
+			if residual > 0 && c[k] < 255 || residual < 0 && c[k] > 0 {
+				free += weight[k]
+			}
+		}
+		if math.Abs(residual) < 1e-6 || free == 0 {
+			break
+		}
+		for k := range c {
+			if residual > 0 && c[k] < 255 || residual < 0 && c[k] > 0 {
+				c[k] += math.Copysign(min(math.Abs(residual/free), 2*math.Abs(d)), residual)
+			}
+		}
+	}
+	return c[0], c[1], c[2]
+}
+
+// pixelReader 返回读取 img 中 (x, y) 处颜色的函数，结果同 readPixel(img.At(x, y))
+// 不透明的 RGBA、NRGBA 和 Gray 直接读像素数组：At 返回 color.Color 接口，每个像素都要一次堆分配，
+// 整张图读下来分配的内存比亮度矩阵本身还多。其余格式和半透明像素仍按 readPixel 换算
+func pixelReader(img image.Image) func(x, y int) (r, g, b float64, a uint32) {
+	generic := func(x, y int) (float64, float64, float64, uint32) { return readPixel(img.At(x, y)) }
+	switch s := img.(type) {
+	case *image.RGBA:
+		return func(x, y int) (float64, float64, float64, uint32) {
+			p := s.Pix[s.PixOffset(x, y):]
+			if p[3] != 0xff {
+				return generic(x, y)
+			}
+			return float64(p[0]), float64(p[1]), float64(p[2]), 0xffff
+		}
+	case *image.NRGBA:
+		return func(x, y int) (float64, float64, float64, uint32) {
+			p := s.Pix[s.PixOffset(x, y):]
+			if p[3] != 0xff {
+				return generic(x, y)
+			}
+			return float64(p[0]), float64(p[1]), float64(p[2]), 0xffff
+		}
+	case *image.Gray:
+		return func(x, y int) (float64, float64, float64, uint32) {
+			v := float64(s.Pix[s.PixOffset(x, y)])
+			return v, v, v, 0xffff
+		}
+	}
+	return generic
+}
+
+// readPixel 读取非预乘的颜色，r, g, b 取值 0-255 (可带小数)，a 为 16 位 alpha
+func readPixel(c color.Color) (r, g, b float64, a uint32) {
+	n := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+	return float64(n.R) / 257, float64(n.G) / 257, float64(n.B) / 257, uint32(n.A)
+}
+
+// writePixel 把非预乘的颜色写入 dst，按 dst 的格式四舍五入到 8 / 16 位，预乘格式会乘上 alpha
+func writePixel(dst draw.Image, x, y int, r, g, b float64, a uint32) {
+	switch d := dst.(type) {
+	case *image.RGBA:
+		d.SetRGBA(x, y, color.RGBA{R: premul(clamp(r), a), G: premul(clamp(g), a), B: premul(clamp(b), a), A: uint8(a >> 8)})
+	case *image.NRGBA:
+		d.SetNRGBA(x, y, color.NRGBA{R: clamp(r), G: clamp(g), B: clamp(b), A: uint8(a >> 8)})
+	case *image.Gray:
+		d.SetGray(x, y, color.Gray{Y: clamp(r)})
+	case *image.Gray16:
+		d.SetGray16(x, y, color.Gray16{Y: clamp16(r)})
+	case *image.NRGBA64:
+		d.SetNRGBA64(x, y, color.NRGBA64{R: clamp16(r), G: clamp16(g), B: clamp16(b), A: uint16(a)})
+	case *image.RGBA64:
+		d.SetRGBA64(x, y, color.RGBA64{R: premul16(clamp16(r), a), G: premul16(clamp16(g), a), B: premul16(clamp16(b), a), A: uint16(a)})
+	default:
+		dst.Set(x, y, color.NRGBA64{R: clamp16(r), G: clamp16(g), B: clamp16(b), A: uint16(a)})
+	}
+}
+
+// clamp16 把 0-255 的值换算为 16 位，四舍五入
+func clamp16(v float64) uint16 {
+	v *= 257
+	if v < 0 {
+		return 0
+	}
+	if v > 0xffff {
+		return 0xffff
+	}
+	return uint16(v + 0.5)
+}
+
+// premul 8 位分量乘上 16 位 alpha
+func premul(v uint8, a uint32) uint8 {
+	return uint8(uint32(v) * a / 0xffff)
+}
+
+// premul16 16 位分量乘上 16 位 alpha
+func premul16(v uint16, a uint32) uint16 {
+	return uint16(uint32(v) * a / 0xffff)
+}
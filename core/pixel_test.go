@@ -0,0 +1,207 @@
+package core
+
+import (
+	"blindwatermark/internal/testimage"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"math"
+	"runtime"
+	"testing"
+)
+
+// withAlpha 把 src 复制到 NRGBA，alpha 从左到右由 255 渐变到 64
+func withAlpha(src image.Image) *image.NRGBA {
+	b := src.Bounds()
+	out := image.NewNRGBA(b)
+	draw.Draw(out, b, src, b.Min, draw.Src)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			out.Pix[out.PixOffset(x, y)+3] = uint8(255 - 191*(x-b.Min.X)/b.Dx())
+		}
+	}
+	return out
+}
+
+// convert 把 src 画到 dst 上并返回 dst
+func convert(dst draw.Image, src image.Image) image.Image {
+	draw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, draw.Src)
+	return dst
+}
+
+// TestPixelFormats 输出与输入的像素格式对应，alpha 原样保留，各格式都能无误提取
+func TestPixelFormats(t *testing.T) {
+	photo := testimage.Photo(t, 320, 240)
+	r := photo.Rect
+	alpha := withAlpha(photo)
+	for _, c := range []struct {
+		src  image.Image
+		want string
+	}{
+		{photo, "*image.RGBA"},
+		{convert(image.NewGray(r), photo), "*image.Gray"},
+		{convert(image.NewGray16(r), photo), "*image.Gray16"},
+		{alpha, "*image.NRGBA"},
+		{convert(image.NewNRGBA64(r), alpha), "*image.NRGBA64"},
+		{convert(image.NewRGBA64(r), alpha), "*image.RGBA64"},
+		{convert(image.NewRGBA(r), alpha), "*image.RGBA"},
+		{convert(image.NewPaletted(r, palette.WebSafe), photo), "*image.RGBA"},
+	} {
+		e := &Engine{Strength: 20}
+		bits := randomBits(e.Capacity(320, 240), 5)
+		out := e.Embed(c.src, bits)
+		name := fmt.Sprintf("%T", c.src)
+		if got := fmt.Sprintf("%T", out); got != c.want {
+			t.Errorf("%s: output is %s, want %s", name, got, c.want)
+		}
+		for y := range 240 {
+			for x := range 320 {
+				_, _, _, wa := c.src.At(x, y).RGBA()
+				if _, _, _, ga := out.At(x, y).RGBA(); ga != wa {
+					t.Fatalf("%s: alpha at (%d, %d) is %#x, want %#x", name, x, y, ga, wa)
+				}
+			}
+		}
+		if ber := bitErrorRate(e.ExtractSoft(out), bits); ber != 0 {
+			t.Errorf("%s: BER %.4f", name, ber)
+		}
+	}
+}
+
+// TestPixelTransparentNotDarkened 半透明像素的颜色按非预乘值修改，平均亮度不变
+func TestPixelTransparentNotDarkened(t *testing.T) {
+	src := withAlpha(testimage.Photo(t, 320, 240))
+	out := (&Engine{Strength: 20}).Embed(src, randomBits(300, 6)).(*image.NRGBA)
+	var sum [2]float64
+	for i := 0; i < len(src.Pix); i += 4 {
+		for k, img := range []*image.NRGBA{src, out} {
+			sum[k] += float64(img.Pix[i]) + float64(img.Pix[i+1]) + float64(img.Pix[i+2])
+		}
+	}
+	n := float64(len(src.Pix) / 4 * 3)
+	if d := (sum[1] - sum[0]) / n; d < -0.5 || d > 0.5 {
+		t.Errorf("mean channel value moved by %.3f", d)
+	}
+}
+
+// TestPixel16Bit 16 位图片的修改量不按 8 位取整：低 8 位与源图不同的像素占多数
+func TestPixel16Bit(t *testing.T) {
+	src := convert(image.NewGray16(image.Rect(0, 0, 320, 240)), testimage.Photo(t, 320, 240)).(*image.Gray16)
+	out := (&Engine{Strength: 20}).Embed(src, randomBits(300, 7)).(*image.Gray16)
+	fine := 0
+	for i := 0; i < len(out.Pix); i += 2 {
+		v := color.Gray16{Y: uint16(out.Pix[i])<<8 | uint16(out.Pix[i+1])}
+		if v.Y%0x101 != 0 { // 8 位值扩展到 16 位时是 0x101 的倍数
+			fine++
+		}
+	}
+	if fine < len(out.Pix)/4 {
+		t.Errorf("only %d of %d pixels use 16-bit precision", fine, len(out.Pix)/2)
+	}
+}
+
+func TestClamp(t *testing.T) {
+	for _, c := range []struct {
+		v    float64
+		want uint8
+	}{
+		{-3, 0}, {-0.4, 0}, {0.49, 0}, {0.5, 1}, {99.99999, 100}, {100.00001, 100},
+		{254.49, 254}, {254.5, 255}, {255, 255}, {300, 255},
+	} {
+		if got := clamp(c.v); got != c.want {
+			t.Errorf("clamp(%v) = %d, want %d", c.v, got, c.want)
+		}
+	}
+	for _, c := range []struct {
+		v    float64
+		want uint16
+	}{
+		{-1, 0}, {0, 0}, {99.99999, 100 * 257}, {128.5, 33025}, {255, 0xffff}, {256, 0xffff},
+	} {
+		if got := clamp16(c.v); got != c.want {
+			t.Errorf("clamp16(%v) = %d, want %d", c.v, got, c.want)
+		}
+	}
+}
+
+// TestEmbedNoBias 取整不引入整体的亮度偏移：嵌入前后各分量的均值相差远小于半个灰阶
+func TestEmbedNoBias(t *testing.T) {
+	src := testimage.Photo(t, 512, 384)
+	out := (&Engine{Strength: 20}).Embed(src, randomBits(500, 8)).(*image.RGBA)
+	var d float64
+	for i, v := range src.Pix {
+		d += float64(out.Pix[i]) - float64(v)
+	}
+	if d /= float64(len(src.Pix)); math.Abs(d) > 0.05 {
+		t.Errorf("mean channel shift %.3f", d)
+	}
+}
+
+// TestRefineClipping 暗部、高光的像素被截断后部分位的系数差不足，Refine 补嵌后这样的位明显减少
+func TestRefineClipping(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		base, sat float64
+	}{{"dark", 8, 15}, {"snow", 250, 5}} {
+		src := synthPhoto(512, 512, c.base, c.sat, 1)
+		weak := make([]int, 2)
+		for i, refine := range []int{0, 2} {
+			e := &Engine{Strength: 20, Refine: refine}
+			bits := randomBits(e.Capacity(512, 512), 9)
+			for k, v := range e.ExtractSoft(e.Embed(src, bits))[:len(bits)] {
+				if !bits[k] {
+					v = -v
+				}
+				if v < refineMargin {
+					weak[i]++
+				}
+			}
+		}
+		t.Logf("%s: weak bits %d without refine, %d with 2 passes", c.name, weak[0], weak[1])
+		if weak[0] == 0 || weak[1]*4 > weak[0] {
+			t.Errorf("%s: weak bits %d without refine, %d with 2 passes", c.name, weak[0], weak[1])
+		}
+	}
+}
+
+// TestRefineMemory 补嵌复用第一遍的矩阵，不再每轮分配新的平面：Refine 2 的总分配与不补嵌时相差无几
+func TestRefineMemory(t *testing.T) {
+	src := synthPhoto(1024, 1024, 8, 15, 2)
+	alloc := make([]uint64, 2)
+	for i, refine := range []int{0, 2} {
+		e := &Engine{Strength: 20, Refine: refine}
+		bits := randomBits(e.Capacity(1024, 1024), 10)
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		e.Embed(src, bits)
+		runtime.ReadMemStats(&after)
+		alloc[i] = after.TotalAlloc - before.TotalAlloc
+	}
+	t.Logf("allocated %d KB without refine, %d KB with 2 passes", alloc[0]>>10, alloc[1]>>10)
+	if alloc[1] > alloc[0]*11/10 {
+		t.Errorf("allocated %d KB without refine, %d KB with 2 passes", alloc[0]>>10, alloc[1]>>10)
+	}
+}
+
+// BenchmarkClipping README 中高光与暗部一节的误码率：512x512 的合成图片，强度 20，JPEG q90
+func BenchmarkClipping(b *testing.B) {
+	for _, c := range []struct {
+		name      string
+		base, sat float64
+	}{{"dark", 8, 15}, {"snow", 250, 5}, {"bright", 245, 20}, {"mid", 128, 30}} {
+		src := synthPhoto(512, 512, c.base, c.sat, 1)
+		for _, refine := range []int{0, 2} {
+			b.Run(fmt.Sprintf("%s/refine=%d", c.name, refine), func(b *testing.B) {
+				e := &Engine{Strength: 20, SyncStrength: 1, Refine: refine}
+				bits := randomBits(e.Capacity(512, 512), 2)
+				var ber float64
+				for b.Loop() {
+					ber = bitErrorRate(e.ExtractSoft(testimage.JPEGRoundTrip(b, e.Embed(src, bits), 90)), bits)
+				}
+				b.ReportMetric(ber*100, "BER-%")
+			})
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package core
+
+import (
+	"blindwatermark/internal/testimage"
+	"fmt"
+	"testing"
+)
+
+// TestCapacitySubbands 每个子带的容量相同；每多一级分解，容量变为 1/4
+func TestCapacitySubbands(t *testing.T) {
+	hl := (&Engine{}).Capacity(1024, 768)
+	if hl != (1024/2/8)*(768/2/8) {
+		t.Fatalf("HL capacity %d", hl)
+	}
+	for _, c := range []struct {
+		subbands Subband
+		factor   int
+	}{
+		{SubbandHL | SubbandLH, 2},
+		{SubbandHL | SubbandLH | SubbandHH, 3},
+		{SubbandHH, 1},
+	} {
+		if got := (&Engine{Subbands: c.subbands}).Capacity(1024, 768); got != c.factor*hl {
+			t.Errorf("subbands %b: capacity %d, want %d", c.subbands, got, c.factor*hl)
+		}
+	}
+	for levels := 2; levels <= 3; levels++ {
+		want := (1024 >> levels / 8) * (768 >> levels / 8)
+		if got := (&Engine{Levels: levels}).Capacity(1024, 768); got != want {
+			t.Errorf("levels %d: capacity %d, want %d", levels, got, want)
+		}
+	}
+}
+
+// TestBlockPositionsDisjoint 各子带的块互不重叠，且都落在最深一级的细节子带内
+func TestBlockPositionsDisjoint(t *testing.T) {
+	e := &Engine{Subbands: SubbandHL | SubbandLH | SubbandHH, Levels: 2}
+	w, h := e.dims(1000, 700)
+	used := map[[2]int]bool{}
+	for _, p := range e.blockPositions(w, h) {
+		if p.X+8 > w>>1 || p.Y+8 > h>>1 || (p.X < w>>2 && p.Y < h>>2) {
+			t.Fatalf("block %v outside the level-2 detail subbands of %dx%d", p, w, h)
+		}
+		for y := p.Y; y < p.Y+8; y++ {
+			for x := p.X; x < p.X+8; x++ {
+				if used[[2]int{x, y}] {
+					t.Fatalf("block %v overlaps another block", p)
+				}
+				used[[2]int{x, y}] = true
+			}
+		}
+	}
+}
+
+// TestEmbedSubbandsLevels 各子带组合和级数都能无误码读回。
+// 同样的强度每深一级，每个像素的改动减半，3 级时已不足半个灰度级、会被取整抵消，因此强度随级数加倍
+func TestEmbedSubbandsLevels(t *testing.T) {
+	src := testimage.Photo(t, 512, 384)
+	for _, subbands := range []Subband{SubbandHL, SubbandLH, SubbandHH, SubbandHL | SubbandLH | SubbandHH} {
+		for levels := 1; levels <= 3; levels++ {
+			t.Run(fmt.Sprintf("%b/%d", subbands, levels), func(t *testing.T) {
+				e := &Engine{Strength: 20 * float64(int(1)<<(levels-1)), Subbands: subbands, Levels: levels, Refine: 2}
+				bits := randomBits(e.Capacity(512, 384), uint64(levels))
+				if ber := bitErrorRate(e.ExtractSoft(e.Embed(src, bits)), bits); ber != 0 {
+					t.Errorf("BER %.4f", ber)
+				}
+			})
+		}
+	}
+}
+
+// TestLevelsJPEG 更深的分解把水印放进更低的频率，同样的强度下 JPEG 压缩后误码更少；HH 最弱
+func TestLevelsJPEG(t *testing.T) {
+	src := testimage.Photo(t, 1024, 768)
+	ber := func(e *Engine) float64 {
+		bits := randomBits(e.Capacity(1024, 768), 7)
+		return bitErrorRate(e.ExtractSoft(testimage.JPEGRoundTrip(t, e.Embed(src, bits), 75)), bits)
+	}
+	hl1 := ber(&Engine{Strength: 20})
+	hl2 := ber(&Engine{Strength: 20, Levels: 2})
+	hh1 := ber(&Engine{Strength: 20, Subbands: SubbandHH})
+	t.Logf("q75 BER: HL level 1 %.4f, HL level 2 %.4f, HH level 1 %.4f", hl1, hl2, hh1)
+	if hl2 >= hl1 || hh1 <= hl1 {
+		t.Errorf("q75 BER: HL level 1 %.4f, HL level 2 %.4f, HH level 1 %.4f", hl1, hl2, hh1)
+	}
+}
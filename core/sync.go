@@ -0,0 +1,523 @@
+package core
+
+import (
+	"image"
+	"math"
+	"math/cmplx"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+// 几何同步模板 (Fourier-Mellin 思路)：
+// 嵌入时在 Y 通道叠加若干固定频率的正弦波，它们在幅度谱上形成一圈峰值。
+// 图片被旋转 / 缩放 / 拉伸后，峰值会跟着做相应的线性变换，
+// 提取时找到这些峰值即可估计出仿射变换，把图片重采样回原始的块网格。
+
+// 模板峰值所在半径 (单位: 周期/像素)
+// 缩放范围 0.5x ~ 2x 时峰值落在 0.095 ~ 0.38 之间，避开直流和奈奎斯特频率
+const templateRadius = 0.19
+
+// 模板峰值的角度 (度)，间隔刻意不均匀，避免旋转某个角度后与自身重合
+var templateAngles = []float64{7, 31, 50, 78, 103, 121, 148, 166}
+
+const (
+	syncMaxWindow = 512  // 粗搜索时频谱窗口的最大边长
+	syncMaxRefine = 1024 // 精细估计时窗口的最大边长
+	syncMinScale  = 0.5  // 模板搜索的最小缩放比例
+	syncMaxScale  = 2.0  // 模板搜索的最大缩放比例
+	syncThreshold = 1.2  // 每个峰值的平均显著度阈值，低于此值认为没有模板
+	syncMaxShift  = 16.0 // 残余平移的搜索范围 (像素)
+)
+
+// Transform 估计出的几何变换
+// M 把原图坐标 (以图片中心为原点) 映射到当前图片坐标 (同样以中心为原点)
+type Transform struct {
+	M     [2][2]float64
+	Angle float64 // 旋转角度 (度)
+	Scale float64 // 平均缩放比例
+}
+
+// addTemplate 在 m 上原地叠加同步模板，按行并行
+// m 的左上角对应原图中的 origin，模板相位以原图左上角为零点。
+// mask 非空时为逐块 (jndBlock x jndBlock 像素) 的幅度系数，见 templateMask
+func addTemplate(m *Matrix, amp float64, origin image.Point, workers int, mask *Matrix) {
+	type freq struct{ fx, fy float64 }
+	freqs := make([]freq, len(templateAngles))
+	for k, deg := range templateAngles {
+		rad := deg * math.Pi / 180
+		freqs[k] = freq{templateRadius * math.Cos(rad), templateRadius * math.Sin(rad)}
+	}
+
+	parallelFor(workers, m.Rows, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			row := m.Row(i)
+			for j := range row {
+				sum := 0.0
+				for _, f := range freqs {
+					sum += math.Cos(2 * math.Pi * (f.fx*float64(origin.X+j) + f.fy*float64(origin.Y+i)))
+				}
+				if mask != nil {
+					sum *= mask.At(i/jndBlock, j/jndBlock)
+				}
+				row[j] += amp * sum
+			}
+		}
+	})
+}
+
+// EstimateTransform 通过同步模板估计图片经历的旋转 / 缩放 / 拉伸
+// 找不到模板时返回 false
+// 注意：实数图像的频谱是中心对称的，旋转 θ 与 θ+180° 无法区分，这里约定旋转角在 ±90° 以内
+func (e *Engine) EstimateTransform(img image.Image) (Transform, bool) {
+	if t, ok := e.estimateTransform(img); ok {
+		return t, true
+	}
+
+	// 放大过的大图中，中心窗口只覆盖原图的一小块，模板峰值的能量不够突出 (1014 像素的示例照片放大 1.7 倍以上时即找不到)。
+	// 缩小一半再找一次：窗口覆盖的原图面积变为 4 倍，缩放比例减半后仍在搜索范围内，找到的变换再放大一倍
+	bounds := img.Bounds()
+	if min(bounds.Dx(), bounds.Dy()) <= syncMaxWindow {
+		return Transform{}, false
+	}
+	half := image.NewRGBA(image.Rect(0, 0, bounds.Dx()/2, bounds.Dy()/2))
+	draw.BiLinear.Scale(half, half.Rect, img, bounds, draw.Src, nil)
+	t, ok := e.estimateTransform(half)
+	if !ok {
+		return Transform{}, false
+	}
+	for a := range 2 {
+		for b := range 2 {
+			t.M[a][b] *= 2
+		}
+	}
+	t.Scale *= 2
+	return t, true
+}
+
+// estimateTransform 在 img 上按原尺寸搜索模板，见 EstimateTransform
+func (e *Engine) estimateTransform(img image.Image) (Transform, bool) {
+	bounds := img.Bounds()
+
+	// 1. 取中心区域，边长为不超过图片短边的 2 的幂
+	size := syncMaxWindow
+	for size > bounds.Dx() || size > bounds.Dy() {
+		size /= 2
+	}
+	if size < 64 {
+		return Transform{}, false
+	}
+	x0 := bounds.Min.X + (bounds.Dx()-size)/2
+	y0 := bounds.Min.Y + (bounds.Dy()-size)/2
+	window := e.lumaMatrix(img, x0, y0, size, size).Slices()
+
+	// 2. 去均值 + 汉宁窗，抑制边界带来的十字形泄漏
+	window = windowed(window)
+
+	// 3. 频谱 -> 对数幅度 -> 减去局部均值，得到“峰值显著度”图
+	spectrum := FFT2D(window)
+	logMag := make([][]float64, size)
+	for i := range spectrum {
+		logMag[i] = make([]float64, size)
+		for j := range spectrum[i] {
+			re, im := real(spectrum[i][j]), imag(spectrum[i][j])
+			logMag[i][j] = math.Log1p(math.Sqrt(re*re + im*im))
+		}
+	}
+	peak := peakiness(logMag, 4)
+
+	// 4. 粗搜索：在 (角度, 缩放) 网格上匹配模板
+	bestScore := math.Inf(-1)
+	var bestAngle, bestScale float64
+	for deg := 0.0; deg < 180; deg += 0.5 {
+		for s := syncMinScale; s <= syncMaxScale; s *= 1.005 {
+			score := 0.0
+			for _, phi := range templateAngles {
+				rad := (phi + deg) * math.Pi / 180
+				r := templateRadius / s * float64(size)
+				score += localMax(peak, r*math.Cos(rad), r*math.Sin(rad), 1)
+			}
+			if score > bestScore {
+				bestScore, bestAngle, bestScale = score, deg, s
+			}
+		}
+	}
+	if bestScore/float64(len(templateAngles)) < syncThreshold {
+		return Transform{}, false
+	}
+
+	// 5. 精细估计：在更大的 (不必是 2 的幂) 窗口上亚像素定位每个峰值，
+	//    再用最小二乘拟合频域线性映射 L (f' = L f)
+	fineW := min(bounds.Dx(), syncMaxRefine)
+	fineH := min(bounds.Dy(), syncMaxRefine)
+	fine := windowed(e.lumaMatrix(img, bounds.Min.X+(bounds.Dx()-fineW)/2, bounds.Min.Y+(bounds.Dy()-fineH)/2, fineW, fineH).Slices())
+	var pq, qq [2][2]float64
+	used := 0
+	for _, phi := range templateAngles {
+		rad := (phi + bestAngle) * math.Pi / 180
+		r := templateRadius / bestScale * float64(size)
+		u, v, strength := refinePeak(logMag, peak, r*math.Cos(rad), r*math.Sin(rad))
+		if strength < syncThreshold {
+			continue
+		}
+		u, v = refineDTFT(fine, u*float64(fineW)/float64(size), v*float64(fineH)/float64(size))
+		qRad := phi * math.Pi / 180
+		q := [2]float64{templateRadius * math.Cos(qRad), templateRadius * math.Sin(qRad)}
+		p := [2]float64{u / float64(fineW), v / float64(fineH)}
+		for a := 0; a < 2; a++ {
+			for b := 0; b < 2; b++ {
+				pq[a][b] += p[a] * q[b]
+				qq[a][b] += q[a] * q[b]
+			}
+		}
+		used++
+	}
+	if used < 3 {
+		return Transform{}, false
+	}
+	L := mul2(pq, inv2(qq))
+
+	// 6. 空间域变换 T = L^{-T}，并按约定把旋转角折回 ±90° 以内
+	T := transpose2(inv2(L))
+	if T[0][0]+T[1][1] < 0 {
+		for a := 0; a < 2; a++ {
+			for b := 0; b < 2; b++ {
+				T[a][b] = -T[a][b]
+			}
+		}
+	}
+	return Transform{
+		M:     T,
+		Angle: math.Atan2(T[1][0], T[0][0]) * 180 / math.Pi,
+		Scale: math.Sqrt(math.Abs(T[0][0]*T[1][1] - T[0][1]*T[1][0])),
+	}, true
+}
+
+// ExtractResync 先用同步模板校正几何变换，再提取 bits
+// 找不到模板时退化为普通的 Extract
+func (e *Engine) ExtractResync(img image.Image) []bool {
+	return HardBits(e.ExtractResyncSoft(img))
+}
+
+// ExtractResyncSoft 同 ExtractResync，返回软判决值 (见 ExtractSoft)
+func (e *Engine) ExtractResyncSoft(img image.Image) []float64 {
+	t, ok := e.EstimateTransform(img)
+	if !ok {
+		return e.ExtractSoft(img)
+	}
+
+	// 先按估计的线性变换重采样，再用模板相位测出残余平移，最后一次性重采样到位。
+	// 第一次只用来读模板的相位，模板频率不高，用更快的双线性插值即可
+	resampled := resample(img, t.M, image.Point{}, [2]float64{}, draw.BiLinear)
+	if resampled == nil {
+		return e.ExtractSoft(img)
+	}
+	size := resampled.Rect.Size()
+	w, h := min(size.X, syncMaxRefine), min(size.Y, syncMaxRefine)
+	x0, y0 := (size.X-w)/2, (size.Y-h)/2
+	shift := estimateShift(e.lumaMatrix(resampled, x0, y0, w, h).Slices(), image.Pt(x0, y0))
+
+	// 按缩放比例换算的原图尺寸可能差一两个像素，块网格的行列数随之改变，整个布局都会错开。
+	// 原图左上角位于 resampled 的 -shift 处；整图提取本来就要求没有裁剪，变换以图片中心为中心，
+	// 右下角与之对称，由此得到原图尺寸。画布两侧各扩大 d 后，同一平移量相对新中心要减去 d
+	orig := image.Pt(int(math.Round(float64(size.X)+2*shift[0])), int(math.Round(float64(size.Y)+2*shift[1])))
+	shift[0] -= float64(orig.X-size.X) / 2
+	shift[1] -= float64(orig.Y-size.Y) / 2
+	return e.ExtractSoft(resample(img, t.M, orig, shift, draw.CatmullRom))
+}
+
+// resample 按变换 m 用 interp 把图片还原到原始网格，输出大小为 size (为零时按缩放比例估计)，再整体平移 shift
+// 输出像素 p 取自源图的 m (p - shift - cDst) + cSrc (cDst、cSrc 分别为输出和源图的中心)
+func resample(img image.Image, m [2][2]float64, size image.Point, shift [2]float64, interp draw.Interpolator) *image.RGBA {
+	bounds := img.Bounds()
+
+	// 1. 估计原图尺寸：x / y 方向各自的缩放量
+	w, h := size.X, size.Y
+	if w == 0 || h == 0 {
+		w = int(math.Round(float64(bounds.Dx()) / math.Hypot(m[0][0], m[1][0])))
+		h = int(math.Round(float64(bounds.Dy()) / math.Hypot(m[0][1], m[1][1])))
+	}
+	if w < 4*N || h < 4*N {
+		return nil
+	}
+
+	// 2. draw 需要的是源 -> 目标的映射: dst = m^{-1} (src - cSrc) + cDst + shift
+	inv := inv2(m)
+	cSrcX := float64(bounds.Min.X) + float64(bounds.Dx())/2
+	cSrcY := float64(bounds.Min.Y) + float64(bounds.Dy())/2
+	cDstX := float64(w)/2 + shift[0]
+	cDstY := float64(h)/2 + shift[1]
+	s2d := f64.Aff3{
+		inv[0][0], inv[0][1], cDstX - inv[0][0]*cSrcX - inv[0][1]*cSrcY,
+		inv[1][0], inv[1][1], cDstY - inv[1][0]*cSrcX - inv[1][1]*cSrcY,
+	}
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	interp.Transform(out, s2d, img, bounds, draw.Src, nil)
+	return out
+}
+
+// estimateShift 根据模板各频率分量的相位估计残余平移 t (满足 out(x) = orig(x + t))
+// window 为当前图片中以 origin 为左上角的一块区域。模板以原图左上角为相位零点，
+// 频率 f 处的相位恰为 2π f·(t + origin)，多个方向的相位联合即可解出 t。
+// 相位从补零到 2 的幂的 FFT 中最近的频点读取：加汉宁窗后峰值附近的频谱是窗函数频谱的平移，
+// 频点比 f 高 δ 时相位少了 π δ·窗口边长 (窗函数关于窗口中心对称)，补回即为 f 处的相位
+func estimateShift(window [][]float64, origin image.Point) [2]float64 {
+	h, w := len(window), len(window[0])
+	size := 1
+	for size < max(w, h) {
+		size <<= 1
+	}
+	padded := make([][]float64, size)
+	for i := range padded {
+		padded[i] = make([]float64, size)
+	}
+	for i, row := range windowed(window) {
+		copy(padded[i], row)
+	}
+	spectrum := FFT2D(padded)
+
+	type measure struct {
+		fx, fy float64
+		phase  float64
+		weight float64
+	}
+	measures := make([]measure, len(templateAngles))
+	for k, deg := range templateAngles {
+		rad := deg * math.Pi / 180
+		fx := templateRadius * math.Cos(rad)
+		fy := templateRadius * math.Sin(rad)
+		u, v := math.Round(fx*float64(size)), math.Round(fy*float64(size))
+		x := spectrum[wrap(int(v), size)][wrap(int(u), size)]
+		phase := cmplx.Phase(x) + math.Pi*((u/float64(size)-fx)*float64(w)+(v/float64(size)-fy)*float64(h))
+		phase -= 2 * math.Pi * (fx*float64(origin.X) + fy*float64(origin.Y))
+		measures[k] = measure{fx, fy, phase, cmplx.Abs(x)}
+	}
+
+	score := func(tx, ty float64) float64 {
+		sum := 0.0
+		for _, m := range measures {
+			sum += m.weight * math.Cos(m.phase-2*math.Pi*(m.fx*tx+m.fy*ty))
+		}
+		return sum
+	}
+
+	// 先粗后细的网格搜索
+	best := [2]float64{}
+	bestScore := math.Inf(-1)
+	for ty := -syncMaxShift; ty <= syncMaxShift; ty += 0.25 {
+		for tx := -syncMaxShift; tx <= syncMaxShift; tx += 0.25 {
+			if sc := score(tx, ty); sc > bestScore {
+				bestScore, best = sc, [2]float64{tx, ty}
+			}
+		}
+	}
+	center := best
+	for ty := center[1] - 0.25; ty <= center[1]+0.25; ty += 0.01 {
+		for tx := center[0] - 0.25; tx <= center[0]+0.25; tx += 0.01 {
+			if sc := score(tx, ty); sc > bestScore {
+				bestScore, best = sc, [2]float64{tx, ty}
+			}
+		}
+	}
+	return best
+}
+
+// peakiness 对数幅度减去 (2r+1)x(2r+1) 邻域均值，突出孤立的尖峰
+func peakiness(logMag [][]float64, r int) [][]float64 {
+	n := len(logMag)
+
+	// 积分图 (循环边界，频谱本身就是周期的)
+	integral := make([][]float64, n+1)
+	for i := range integral {
+		integral[i] = make([]float64, n+1)
+	}
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			integral[i+1][j+1] = logMag[i][j] + integral[i][j+1] + integral[i+1][j] - integral[i][j]
+		}
+	}
+	boxSum := func(i0, j0, i1, j1 int) float64 {
+		return integral[i1][j1] - integral[i0][j1] - integral[i1][j0] + integral[i0][j0]
+	}
+
+	output := make([][]float64, n)
+	area := float64((2*r + 1) * (2*r + 1))
+	for i := 0; i < n; i++ {
+		output[i] = make([]float64, n)
+		for j := 0; j < n; j++ {
+			sum := 0.0
+			// 按循环边界拆成至多 4 个矩形
+			for _, ri := range wrapRanges(i-r, i+r+1, n) {
+				for _, rj := range wrapRanges(j-r, j+r+1, n) {
+					sum += boxSum(ri[0], rj[0], ri[1], rj[1])
+				}
+			}
+			output[i][j] = logMag[i][j] - sum/area
+		}
+	}
+	return output
+}
+
+// wrapRanges 把 [lo, hi) 按周期 n 拆分成落在 [0, n) 内的区间
+func wrapRanges(lo, hi, n int) [][2]int {
+	if lo < 0 {
+		return [][2]int{{lo + n, n}, {0, hi}}
+	}
+	if hi > n {
+		return [][2]int{{lo, n}, {0, hi - n}}
+	}
+	return [][2]int{{lo, hi}}
+}
+
+// localMax 返回频率 (u, v) (单位: 频点，可为负) 附近 (2r+1)x(2r+1) 范围内的最大值
+func localMax(m [][]float64, u, v float64, r int) float64 {
+	n := len(m)
+	cu := int(math.Round(u))
+	cv := int(math.Round(v))
+	best := math.Inf(-1)
+	for dv := -r; dv <= r; dv++ {
+		for du := -r; du <= r; du++ {
+			val := m[wrap(cv+dv, n)][wrap(cu+du, n)]
+			if val > best {
+				best = val
+			}
+		}
+	}
+	return best
+}
+
+// refinePeak 在预测位置附近找到峰值，并用抛物线插值得到亚像素频率
+func refinePeak(logMag, peak [][]float64, u, v float64) (float64, float64, float64) {
+	n := len(logMag)
+	cu := int(math.Round(u))
+	cv := int(math.Round(v))
+	best := math.Inf(-1)
+	bu, bv := cu, cv
+	for dv := -2; dv <= 2; dv++ {
+		for du := -2; du <= 2; du++ {
+			val := logMag[wrap(cv+dv, n)][wrap(cu+du, n)]
+			if val > best {
+				best, bu, bv = val, cu+du, cv+dv
+			}
+		}
+	}
+
+	at := func(uu, vv int) float64 { return logMag[wrap(vv, n)][wrap(uu, n)] }
+	return float64(bu) + parabolic(at(bu-1, bv), best, at(bu+1, bv)),
+		float64(bv) + parabolic(at(bu, bv-1), best, at(bu, bv+1)),
+		peak[wrap(bv, n)][wrap(bu, n)]
+}
+
+// windowed 返回去均值并乘上二维汉宁窗后的矩阵
+func windowed(matrix [][]float64) [][]float64 {
+	h := len(matrix)
+	w := len(matrix[0])
+	mean := 0.0
+	for i := range matrix {
+		for j := range matrix[i] {
+			mean += matrix[i][j]
+		}
+	}
+	mean /= float64(w * h)
+
+	hann := func(i, n int) float64 {
+		return 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n))
+	}
+	output := make([][]float64, h)
+	for i := range matrix {
+		output[i] = make([]float64, w)
+		for j := range matrix[i] {
+			output[i][j] = (matrix[i][j] - mean) * hann(i, h) * hann(j, w)
+		}
+	}
+	return output
+}
+
+// refineDTFT 直接在连续频率上计算 DTFT 幅度，迭代逼近峰值的精确位置
+// 块网格对齐要求整幅图的累计误差在 1 像素以内，仅靠 FFT 频点插值精度不够
+func refineDTFT(window [][]float64, u, v float64) (float64, float64) {
+	h := len(window)
+	w := len(window[0])
+	phasor := make([]complex128, w)
+	rowSums := make([]complex128, h)
+
+	// 对固定的水平频率 fu，预先算出每一行的加权和
+	prepare := func(fu float64) {
+		for x := 0; x < w; x++ {
+			phasor[x] = cmplx.Exp(complex(0, -2*math.Pi*fu*float64(x)/float64(w)))
+		}
+		for y := 0; y < h; y++ {
+			var sum complex128
+			for x, val := range window[y] {
+				sum += complex(val, 0) * phasor[x]
+			}
+			rowSums[y] = sum
+		}
+	}
+	power := func(fv float64) float64 {
+		var sum complex128
+		for y := 0; y < h; y++ {
+			sum += rowSums[y] * cmplx.Exp(complex(0, -2*math.Pi*fv*float64(y)/float64(h)))
+		}
+		return real(sum)*real(sum) + imag(sum)*imag(sum)
+	}
+
+	step := 0.5
+	for iter := 0; iter < 5; iter++ {
+		// 水平方向
+		var p [3]float64
+		for k := 0; k < 3; k++ {
+			prepare(u + float64(k-1)*step)
+			p[k] = power(v)
+		}
+		u += parabolic(p[0], p[1], p[2]) * step
+
+		// 竖直方向
+		prepare(u)
+		for k := 0; k < 3; k++ {
+			p[k] = power(v + float64(k-1)*step)
+		}
+		v += parabolic(p[0], p[1], p[2]) * step
+
+		step /= 3
+	}
+	return u, v
+}
+
+// parabolic 三点抛物线插值，返回顶点相对中心点的偏移
+func parabolic(left, center, right float64) float64 {
+	denom := left - 2*center + right
+	if denom == 0 {
+		return 0
+	}
+	offset := 0.5 * (left - right) / denom
+	return math.Max(-0.5, math.Min(0.5, offset))
+}
+
+func wrap(i, n int) int {
+	i %= n
+	if i < 0 {
+		i += n
+	}
+	return i
+}
+
+// 2x2 矩阵的小工具
+func mul2(a, b [2][2]float64) [2][2]float64 {
+	return [2][2]float64{
+		{a[0][0]*b[0][0] + a[0][1]*b[1][0], a[0][0]*b[0][1] + a[0][1]*b[1][1]},
+		{a[1][0]*b[0][0] + a[1][1]*b[1][0], a[1][0]*b[0][1] + a[1][1]*b[1][1]},
+	}
+}
+
+func inv2(a [2][2]float64) [2][2]float64 {
+	det := a[0][0]*a[1][1] - a[0][1]*a[1][0]
+	return [2][2]float64{
+		{a[1][1] / det, -a[0][1] / det},
+		{-a[1][0] / det, a[0][0] / det},
+	}
+}
+
+func transpose2(a [2][2]float64) [2][2]float64 {
+	return [2][2]float64{{a[0][0], a[1][0]}, {a[0][1], a[1][1]}}
+}
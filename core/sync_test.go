@@ -0,0 +1,109 @@
+package core
+
+import (
+	"blindwatermark/internal/testimage"
+	"image"
+	"math"
+	"testing"
+)
+
+// geometryCases 旋转 (度) 和缩放的组合，覆盖常见的截图、转发缩放和轻微旋转
+var geometryCases = []struct {
+	angle, scale float64
+}{
+	{0, 0.8},
+	{0, 1.25},
+	{3, 1},
+	{-5, 1},
+	{10, 1},
+	{5, 0.8},
+	{-7, 1.25},
+}
+
+func TestEstimateTransform(t *testing.T) {
+	e := &Engine{Strength: 20, SyncStrength: 1}
+	marked := e.Embed(testimage.Photo(t, 512, 512), nil)
+	for _, c := range geometryCases {
+		got, ok := e.EstimateTransform(testimage.RotateScale(marked, c.angle, c.scale))
+		if !ok {
+			t.Errorf("rotate %v scale %v: template not found", c.angle, c.scale)
+			continue
+		}
+		if math.Abs(got.Angle-c.angle) > 0.1 || math.Abs(got.Scale/c.scale-1) > 0.005 {
+			t.Errorf("rotate %v scale %v: estimated rotate %.3f scale %.4f", c.angle, c.scale, got.Angle, got.Scale)
+		}
+	}
+}
+
+// TestEstimateTransformRange 搜索范围的两端 (0.5x、2x、接近 ±90°)，带数据的大图放大 1.7 倍以上时要靠缩小一半后的重试
+func TestEstimateTransformRange(t *testing.T) {
+	if testing.Short() {
+		t.Skip("resampling a 1014x1014 image up to 2x")
+	}
+	e := &Engine{Strength: 20, SyncStrength: 1, Levels: 2}
+	marked := e.Embed(testimage.Photo(t, 1014, 1014), randomBits(e.Capacity(1014, 1014), 2))
+	for _, c := range []struct{ angle, scale float64 }{
+		{0, syncMinScale}, {0, 1.7}, {0, syncMaxScale}, {20, syncMaxScale}, {-20, syncMinScale}, {89, 1}, {-89, 1},
+	} {
+		got, ok := e.EstimateTransform(testimage.RotateScale(marked, c.angle, c.scale))
+		if !ok {
+			t.Errorf("rotate %v scale %v: template not found", c.angle, c.scale)
+			continue
+		}
+		if math.Abs(got.Angle-c.angle) > 0.1 || math.Abs(got.Scale/c.scale-1) > 0.005 {
+			t.Errorf("rotate %v scale %v: estimated rotate %.3f scale %.4f", c.angle, c.scale, got.Angle, got.Scale)
+		}
+	}
+}
+
+func TestEstimateTransformWithoutTemplate(t *testing.T) {
+	e := &Engine{Strength: 20}
+	for _, size := range []int{512, 1014} {
+		marked := e.Embed(testimage.Photo(t, size, size), randomBits(e.Capacity(size, size), 1))
+		for _, scale := range []float64{0.9, 1.8} {
+			if got, ok := e.EstimateTransform(testimage.RotateScale(marked, 5, scale)); ok {
+				t.Errorf("%dx%d scale %v: found a template that was never embedded: %+v", size, size, scale, got)
+			}
+		}
+	}
+}
+
+// TestEstimateShift 模板相位与平移方向一致：左上角对应原图 (tx, ty) 的区域测出的平移为 (tx, ty)
+func TestEstimateShift(t *testing.T) {
+	for _, shift := range []image.Point{{0, 0}, {3, -2}, {-7, 5}, {11, 13}} {
+		m := NewMatrix(300, 400)
+		addTemplate(m, 1, shift, 1, nil)
+		window := m.View(20, 30, 256, 300)
+		got := estimateShift(window.Slices(), image.Pt(30, 20))
+		if math.Abs(got[0]-float64(shift.X)) > 0.05 || math.Abs(got[1]-float64(shift.Y)) > 0.05 {
+			t.Errorf("shift %v: estimated %.2f", shift, got)
+		}
+	}
+}
+
+// TestExtractResync 旋转 / 缩放后直接提取只能得到噪声，按模板校正后大部分位恢复。
+// 重采样会削弱细节子带，转出画布的角落也会丢失，剩下的误码要靠纠错编码和冗余嵌入
+func TestExtractResync(t *testing.T) {
+	e := &Engine{Strength: 20, SyncStrength: 1, Levels: 2, Refine: 2}
+	bits := randomBits(e.Capacity(512, 512), 1)
+	marked := e.Embed(testimage.Photo(t, 512, 512), bits)
+	for _, c := range geometryCases {
+		img := testimage.RotateScale(marked, c.angle, c.scale)
+		resync := bitErrorRate(e.ExtractResyncSoft(img), bits)
+		t.Logf("rotate %v scale %v: BER %.3f", c.angle, c.scale, resync)
+		if resync > 0.1 {
+			t.Errorf("rotate %v scale %v: BER %.3f after resync", c.angle, c.scale, resync)
+		}
+	}
+}
+
+// BenchmarkSyncTemplate 只嵌入同步模板的耗时和画质 (PSNR)，模板的失真与 Strength 无关
+func BenchmarkSyncTemplate(b *testing.B) {
+	src := testimage.Photo(b, 1024, 1014)
+	e := &Engine{Strength: 20, SyncStrength: 1}
+	var out image.Image
+	for b.Loop() {
+		out = e.Embed(src, nil)
+	}
+	b.ReportMetric(psnr(src, out), "dB")
+}
@@ -0,0 +1,291 @@
+package core
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+// 分块 (tile) 模式：
+// 图片按 TileSize 切成互不重叠的正方形分块，边长对齐到嵌入网格 (blockSize << levels，8x8 分块、1 级分解时为 16 像素)，
+// 每个分块独立做 DWT + DCT 并嵌入一份完整的 bits。内存只与分块大小有关，
+// 任何一个完整保留下来的分块都能单独解出水印，因此也能抵抗裁剪。
+// 各分块的变换在自身边界处闭合，提取端按同样的网格切块即可逐位还原，分块之间不需要重叠和拼接。
+// 同步模板的相位以整张图为准，跨分块连续，ExtractResync 不受影响
+//
+// 分块不重叠：一个像素只能承载一份嵌入，重叠区域里两个分块的系数对会互相改写，
+// 要么各自只剩一半强度，要么后写的分块破坏先写的。抗裁剪只取决于能否留下一个完整分块：
+// 宽高都不小于 2 x TileSize - 1 的任意裁剪必然包含一个完整分块，需要抵抗更小的裁剪时应减小 TileSize
+
+// tileSize 实际的分块边长，0 表示不分块
+func (e *Engine) tileSize() int {
+	if e.TileSize <= 0 {
+		return 0
+	}
+	grid := e.grid()
+	return max(e.TileSize-e.TileSize%grid, grid)
+}
+
+// grid 嵌入网格的边长 (像素)：最深一级子带中的一个 DCT 块对应原图 blockSize << levels 像素
+func (e *Engine) grid() int {
+	return e.blockSize() << e.levels()
+}
+
+// embedTiled 分块模式下的 Embed，输出与输入等大、像素格式相同，分块裁剪剩下的边角保持原样
+func (e *Engine) embedTiled(img image.Image, bits []bool) image.Image {
+	bounds := img.Bounds()
+	out := e.newOutput(img, image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	t := e.tileSize()
+	for y := 0; y < bounds.Dy(); y += t {
+		e.embedBand(img, bits, out, image.Rect(0, y, bounds.Dx(), min(y+t, bounds.Dy())))
+	}
+	return out
+}
+
+// embedBand 处理一行分块：band 为输出坐标 (左上角为 (0, 0)) 中的行范围，结果写入 dst 的同一位置
+func (e *Engine) embedBand(img image.Image, bits []bool, dst image.Image, band image.Rectangle) {
+	bounds := img.Bounds()
+	t := e.tileSize()
+
+	// 先原样复制，分块中不足 2^levels 的边角行列不参与变换
+	copyRect(dst, band, img, bounds.Min.Add(band.Min))
+	for x := band.Min.X; x < band.Max.X; x += t {
+		tile := image.Rect(x, band.Min.Y, min(x+t, band.Max.X), band.Max.Y)
+		e.embedRegion(img, bits, tile.Add(bounds.Min), dst, bounds.Min)
+	}
+}
+
+// EmbedBands 按行分块嵌入，每完成一行分块就调用一次 fn，适合边嵌入边写出
+// band 的坐标与 Embed 的输出一致 (左上角为 (0, 0))，像素格式同 Embed，高度为分块边长 (最后一行可能更矮)。
+// fn 返回错误时立即停止并返回该错误。未设置 TileSize 时整张图作为一行
+func (e *Engine) EmbedBands(img image.Image, bits []bool, fn func(band image.Image) error) error {
+	t := e.tileSize()
+	if t == 0 {
+		return fn(e.Embed(img, bits))
+	}
+	bounds := img.Bounds()
+	for y := 0; y < bounds.Dy(); y += t {
+		r := image.Rect(0, y, bounds.Dx(), min(y+t, bounds.Dy()))
+		band := e.newOutput(img, r)
+		e.embedBand(img, bits, band, r)
+		if err := fn(band); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EmbedStream 返回按需嵌入的图片，内容与 Embed 相同
+// 只缓存最近访问的一行分块：按行顺序读取时 (png.Encode、jpeg.Encode 等)，输出只占一行分块的内存；
+// 随机访问会反复重算，此时应使用 Embed。可以并发读取。未设置 TileSize 时等同于 Embed
+func (e *Engine) EmbedStream(img image.Image, bits []bool) image.Image {
+	if e.tileSize() == 0 {
+		return e.Embed(img, bits)
+	}
+	bounds := img.Bounds()
+	return &streamImage{e: e, src: img, bits: bits, rect: image.Rect(0, 0, bounds.Dx(), bounds.Dy())}
+}
+
+// streamImage EmbedStream 返回的图片
+type streamImage struct {
+	e    *Engine
+	src  image.Image
+	bits []bool
+	rect image.Rectangle
+
+	band atomic.Pointer[streamBand] // 当前缓存的一行分块，发布后只读
+	mu   sync.Mutex                 // 只在重算一行分块时持有，读取缓存不加锁
+}
+
+// streamBand 嵌入好的一行分块，覆盖输出中 [top, bottom) 行
+type streamBand struct {
+	img         image.Image
+	top, bottom int
+}
+
+func (s *streamImage) ColorModel() color.Model {
+	return s.e.newOutput(s.src, image.Rectangle{}).ColorModel()
+}
+
+func (s *streamImage) Bounds() image.Rectangle { return s.rect }
+
+func (s *streamImage) At(x, y int) color.Color {
+	p := image.Pt(x, y)
+	if !p.In(s.rect) {
+		return color.RGBA{}
+	}
+	return s.bandAt(y).At(x, y)
+}
+
+// bandAt 返回包含第 y 行的一行分块
+// 命中缓存时只有一次原子读取；未命中时加锁重算，同一行分块只算一次，其他读者等待后直接使用
+func (s *streamImage) bandAt(y int) image.Image {
+	if b := s.band.Load(); b != nil && y >= b.top && y < b.bottom {
+		return b.img
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if b := s.band.Load(); b != nil && y >= b.top && y < b.bottom {
+		return b.img
+	}
+	t := s.e.tileSize()
+	top := y - y%t
+	r := image.Rect(0, top, s.rect.Dx(), min(top+t, s.rect.Dy()))
+	band := s.e.newOutput(s.src, r)
+	s.e.embedBand(s.src, s.bits, band, r)
+	s.band.Store(&streamBand{img: band, top: r.Min.Y, bottom: r.Max.Y})
+	return band
+}
+
+// extractTiles 按以 anchor 为某个分块左上角的网格切块提取，各分块的软判决值按位置取平均
+// 每个分块都从第 0 位开始存放 bits，较小的边缘分块只存得下开头一段。
+// fullOnly 为 true 时只使用完整的分块：裁剪后边缘的残缺分块与嵌入时的布局不一致
+func (e *Engine) extractTiles(img image.Image, anchor image.Point, fullOnly bool) []float64 {
+	bounds := img.Bounds()
+	t := e.tileSize()
+	sum := make([]float64, e.ImageCapacity(img))
+	count := make([]int, len(sum))
+
+	x0 := bounds.Min.X - ((bounds.Min.X-anchor.X)%t+t)%t
+	y0 := bounds.Min.Y - ((bounds.Min.Y-anchor.Y)%t+t)%t
+	for y := y0; y < bounds.Max.Y; y += t {
+		for x := x0; x < bounds.Max.X; x += t {
+			full := image.Rect(x, y, x+t, y+t)
+			tile := full.Intersect(bounds)
+			if fullOnly && tile != full {
+				continue
+			}
+			for k, v := range e.extractRegion(img, tile) {
+				sum[k] += v
+				count[k]++
+			}
+		}
+	}
+	for k := range sum {
+		if count[k] > 0 {
+			sum[k] /= float64(count[k])
+		}
+	}
+	return sum
+}
+
+// ExtractCroppedSoft 分块模式下从裁剪过的图片中提取软判决值 (见 ExtractSoft)
+// 先用 FindTileOrigin 找到分块网格，再平均所有完整保留下来的分块；找不到时退化为 ExtractSoft
+func (e *Engine) ExtractCroppedSoft(img image.Image) []float64 {
+	origin, ok := e.FindTileOrigin(img)
+	if !ok {
+		return e.ExtractSoft(img)
+	}
+	return e.extractTiles(img, origin, true)
+}
+
+// FindTileOrigin 分块模式下搜索分块网格的位置，返回某个完整分块左上角的坐标
+// 裁剪会让网格相对图片左上角平移未知的距离。这里在左上角 2 x TileSize 的窗口内
+// 逐一尝试 grid x grid 种像素对齐和 (TileSize / grid)^2 种分块相位，取嵌入系数对最突出的一种。
+// 窗口平移 2^levels 像素相当于 DWT 系数平移一格，因此只需做 2^levels x 2^levels 次整窗 DWT，
+// 其余对齐方式和各分块相位都在 DWT 系数上按偏移取块。Haar 的变换是局部的，这与单独变换分块完全一致，
+// 其他小波只在分块边界附近略有差别，不影响比较。图片放不下一个完整分块时返回 false
+func (e *Engine) FindTileOrigin(img image.Image) (image.Point, bool) {
+	t := e.tileSize()
+	bounds := img.Bounds()
+	if t == 0 || bounds.Dx() < t || bounds.Dy() < t {
+		return image.Point{}, false
+	}
+	window := e.lumaMatrix(img, bounds.Min.X, bounds.Min.Y, min(bounds.Dx(), 2*t), min(bounds.Dy(), 2*t))
+	slots := e.slots(t, t)
+	step := 1 << e.levels()
+
+	best := tileCandidate{score: math.Inf(-1)}
+	for ry := 0; ry < step; ry++ {
+		for rx := 0; rx < step; rx++ {
+			w := (window.Cols - rx) / step * step
+			h := (window.Rows - ry) / step * step
+			if w < t || h < t {
+				continue
+			}
+			m := window.View(ry, rx, h, w).Clone()
+			dwt2DLevels(m, e.levels(), e.Wavelet, e.workers())
+
+			// DWT 系数再偏移 (sx, sy) 格，对应像素对齐 (rx + sx<<levels, ry + sy<<levels)
+			n := e.blockSize()
+			candidates := make([]tileCandidate, n*n)
+			parallelFor(e.workers(), len(candidates), func(lo, hi int) {
+				for s := lo; s < hi; s++ {
+					candidates[s] = e.bestTilePhase(m, s%n, s/n, slots)
+				}
+			})
+			for _, c := range candidates {
+				if c.score > best.score {
+					best = tileCandidate{origin: c.origin.Add(image.Pt(rx, ry)), score: c.score}
+				}
+			}
+		}
+	}
+	return bounds.Min.Add(best.origin), !math.IsInf(best.score, -1)
+}
+
+// tileCandidate 一种分块网格的位置和得分
+type tileCandidate struct {
+	origin image.Point
+	score  float64
+}
+
+// bestTilePhase 在做过 DWT 的窗口 m 中，子带坐标偏移 (sx, sy) 格时得分最高的分块相位，返回的位置相对 m 的左上角
+// 得分为各落点选中的系数对差值 |d| 的均值与同一批块中其余候选系数对 |d| 的均值之比：
+// 嵌入时被拉开的系数对明显突出，比值大于 1；错位时选中的系数对与其余无异，比值约为 1。
+// 分子分母来自同样的块，纹理强弱互相抵消，不会偏向纹理丰富的错位。
+// 差值按嵌入强度截断：嵌入后的系数对都不小于强度，截断不损失信号；错位时 (尤其是错开两个系数、
+// 中频基函数近似反相的位置) 少数纹理很强的块会拉高均值，截断后不再能压过真正的位置。
+// QIM / STDM 不拉开系数，改看落在格点上的程度：软判决值绝对值的均值与错位时的期望 0.5 之比
+func (e *Engine) bestTilePhase(m *Matrix, sx, sy int, slots []slot) tileCandidate {
+	t, grid, levels, n := e.tileSize(), e.grid(), e.levels(), e.blockSize()
+	sw, sh, ts := m.Cols>>levels, m.Rows>>levels, t>>levels
+	step, pairs := e.strength(channelY), e.pairs()
+	best := tileCandidate{score: math.Inf(-1)}
+
+	// 各子带中从 (sy, sx) 起按 n 对齐的块，DCT 按需计算并缓存
+	rows, cols := (sh-sy)/n, (sw-sx)/n
+	if rows <= 0 || cols <= 0 {
+		return best
+	}
+	cache := make([][]float64, 4*rows*cols)
+	coeffs := func(qy, qx, bi, bj int) []float64 {
+		k := ((qy*2+qx)*rows+bi)*cols + bj
+		if cache[k] == nil {
+			cache[k] = make([]float64, n*n)
+			m.block(qy*sh+sy+bi*n, qx*sw+sx+bj*n, n, cache[k])
+			FastDCT(cache[k], n)
+		}
+		return cache[k]
+	}
+
+	for py := 0; py < t && sy+(py+t)>>levels <= sh; py += grid {
+		for px := 0; px < t && sx+(px+t)>>levels <= sw; px += grid {
+			var selected, others float64
+			for _, sl := range slots {
+				// 分块内的落点映射到整窗 DWT 中同一子带的对应块
+				block := coeffs(sl.pos.Y/ts, sl.pos.X/ts, (py>>levels+sl.pos.Y%ts)/n, (px>>levels+sl.pos.X%ts)/n)
+				if e.Modulation != ModulationPair {
+					selected += math.Abs(e.demodulate(block, sl, step))
+					continue
+				}
+				d := math.Min(math.Abs(block[sl.c1[0]*n+sl.c1[1]]-block[sl.c2[0]*n+sl.c2[1]]), step)
+				selected += d
+				others -= d
+				for _, p := range pairs {
+					others += math.Min(math.Abs(block[p[0][0]*n+p[0][1]]-block[p[1][0]*n+p[1][1]]), step)
+				}
+			}
+			score := selected * float64(len(pairs)-1) / math.Max(others, 1e-9)
+			if e.Modulation != ModulationPair {
+				score = selected / (0.5 * float64(len(slots)))
+			}
+			if score > best.score {
+				best = tileCandidate{origin: image.Pt(sx<<levels+px, sy<<levels+py), score: score}
+			}
+		}
+	}
+	return best
+}
@@ -0,0 +1,164 @@
+package core
+
+import (
+	"blindwatermark/internal/testimage"
+	"bytes"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestEmbedStream EmbedStream 和 EmbedBands 的输出与 Embed 逐像素相同，并发读取也一样
+func TestEmbedStream(t *testing.T) {
+	src := testimage.Photo(t, 700, 600) // 宽高都不是分块边长的整数倍
+	e := &Engine{Strength: 20, TileSize: 256}
+	bits := randomBits(e.Capacity(700, 600), 1)
+	want := e.Embed(src, bits).(*image.RGBA)
+
+	stream := e.EmbedStream(src, bits)
+	if stream.Bounds() != want.Rect {
+		t.Fatalf("stream bounds %v, want %v", stream.Bounds(), want.Rect)
+	}
+	got := image.NewRGBA(want.Rect)
+	var wg sync.WaitGroup
+	for w := range 4 {
+		wg.Go(func() {
+			// 各读者从不同的行开始，交错触发分块重算
+			for i := range want.Rect.Dy() {
+				y := (i + w*150) % want.Rect.Dy()
+				for x := range want.Rect.Dx() {
+					got.Set(x, y, stream.At(x, y))
+				}
+			}
+		})
+	}
+	wg.Wait()
+	if !bytes.Equal(got.Pix, want.Pix) {
+		t.Error("EmbedStream differs from Embed")
+	}
+
+	bands := image.NewRGBA(want.Rect)
+	err := e.EmbedBands(src, bits, func(band image.Image) error {
+		draw.Draw(bands, band.Bounds(), band, band.Bounds().Min, draw.Src)
+		return nil
+	})
+	if err != nil || !bytes.Equal(bands.Pix, want.Pix) {
+		t.Errorf("EmbedBands differs from Embed: %v", err)
+	}
+}
+
+// TestTileCrop 裁剪掉左上角任意行列后，FindTileOrigin 找回分块网格，ExtractCroppedSoft 无误码
+// 宽高不小于 2 x TileSize - 1 的裁剪必然包含一个完整分块
+func TestTileCrop(t *testing.T) {
+	if testing.Short() {
+		t.Skip("searching the tile grid in twelve crops")
+	}
+	const tile = 256
+	src := testimage.Photo(t, 900, 800)
+	for _, e := range []*Engine{
+		{Strength: 20, TileSize: tile},
+		{Strength: 20, TileSize: tile, Key: []byte("k"), Modulation: ModulationSTDM},
+	} {
+		bits := randomBits(e.Capacity(tile, tile), 2)
+		marked := e.Embed(src, bits)
+		for _, off := range []image.Point{{37, 91}, {200, 5}, {129, 255}} {
+			crop := image.NewRGBA(image.Rect(0, 0, 2*tile-1, 2*tile-1))
+			draw.Draw(crop, crop.Rect, marked, off, draw.Src)
+
+			origin, ok := e.FindTileOrigin(crop)
+			// 任意一个完整分块的左上角都可以，按分块边长取模比较
+			want := image.Pt((tile-off.X%tile)%tile, (tile-off.Y%tile)%tile)
+			if !ok || origin.Mod(image.Rect(0, 0, tile, tile)) != want {
+				t.Errorf("%+v, crop at %v: origin %v (%v), want %v", e.Modulation, off, origin, ok, want)
+				continue
+			}
+			if ber := bitErrorRate(e.ExtractCroppedSoft(crop)[:len(bits)], bits); ber > 0 {
+				t.Errorf("%+v, crop at %v: BER %.4f", e.Modulation, off, ber)
+			}
+
+			// 裁剪后再经 JPEG q95，压缩网格与水印网格错位，仍应找到同一网格
+			if origin, _ := e.FindTileOrigin(testimage.JPEGRoundTrip(t, crop, 95)); origin.Mod(image.Rect(0, 0, tile, tile)) != want {
+				t.Errorf("%+v, crop at %v after JPEG q95: origin %v, want %v", e.Modulation, off, origin, want)
+			}
+		}
+	}
+}
+
+// TestFindTileOriginSmall 放不下一个完整分块时不搜索
+func TestFindTileOriginSmall(t *testing.T) {
+	e := &Engine{Strength: 20, TileSize: 256}
+	if _, ok := e.FindTileOrigin(testimage.Photo(t, 255, 600)); ok {
+		t.Error("found a tile origin in an image narrower than a tile")
+	}
+	if _, ok := (&Engine{Strength: 20}).FindTileOrigin(testimage.Photo(t, 600, 600)); ok {
+		t.Error("found a tile origin without TileSize")
+	}
+}
+
+// BenchmarkTiled24MP 2400 万像素的图片整图嵌入、按行分块嵌入和流式编码 PNG 的耗时、总分配和堆内存峰值
+// peak-MB 为嵌入期间 (不含输入图片) 每 10ms 采样一次的 HeapInuse 最大值，只作量级参考
+func BenchmarkTiled24MP(b *testing.B) {
+	photo := testimage.Photo(b, 1500, 1000)
+	src := image.NewRGBA(image.Rect(0, 0, 6000, 4000))
+	for y := 0; y < 4000; y += 1000 {
+		for x := 0; x < 6000; x += 1500 {
+			draw.Draw(src, image.Rect(x, y, x+1500, y+1000), photo, image.Point{}, draw.Src)
+		}
+	}
+	whole := &Engine{Strength: 20}
+	tiled := &Engine{Strength: 20, TileSize: 512}
+	bits := randomBits(tiled.Capacity(512, 512), 1)
+
+	for _, c := range []struct {
+		name string
+		run  func()
+	}{
+		{"whole", func() { whole.Embed(src, bits) }},
+		{"bands", func() { tiled.EmbedBands(src, bits, func(image.Image) error { return nil }) }},
+		{"whole+png", func() { png.Encode(io.Discard, whole.Embed(src, bits)) }},
+		{"tiled+png", func() { png.Encode(io.Discard, tiled.Embed(src, bits)) }},
+		{"stream+png", func() { png.Encode(io.Discard, tiled.EmbedStream(src, bits)) }},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			var peak uint64
+			for b.Loop() {
+				runtime.GC()
+				peak = max(peak, peakHeap(c.run))
+			}
+			b.ReportMetric(float64(peak)/(1<<20), "peak-MB")
+		})
+	}
+}
+
+// peakHeap 运行 fn 期间相对开始时增加的 HeapInuse 的最大值
+func peakHeap(fn func()) uint64 {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	base, peak := ms.HeapInuse, ms.HeapInuse
+
+	done := make(chan struct{})
+	sampled := make(chan uint64)
+	go func() {
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				sampled <- peak
+				return
+			case <-ticker.C:
+				runtime.ReadMemStats(&ms)
+				peak = max(peak, ms.HeapInuse)
+			}
+		}
+	}()
+	fn()
+	close(done)
+	return <-sampled - base
+}
@@ -0,0 +1,196 @@
+package core
+
+// Wavelet 一维离散小波变换
+// Forward 把长度为偶数的信号 src 变换为 [L..., H...] (低频在前，高频在后) 写入 dst，Inverse 为其逆变换
+// dst 与 src 等长且不能重叠；Inverse 可能把 src 当作工作区而修改它。两者都不分配内存
+// 为了让 Engine.Strength 在不同小波下含义相近，各实现都归一化为：
+// 常数信号 [1, 1, ...] 的低频增益、交替信号 [1, -1, ...] 的高频增益均为 sqrt(2)，与正交 Haar 一致
+type Wavelet interface {
+	Name() string
+	Forward(dst, src []float64)
+	Inverse(dst, src []float64)
+}
+
+// 可选的小波基
+var (
+	Haar  Wavelet = haar{}
+	DB2   Wavelet = newDaubechies("db2", []float64{0.4829629131445341, 0.8365163037378079, 0.2241438680420134, -0.1294095225512604})
+	DB4   Wavelet = newDaubechies("db4", []float64{0.2303778133088964, 0.7148465705529154, 0.6308807679298587, -0.0279837694168599, -0.1870348117190931, 0.0308413818355607, 0.0328830116668852, -0.0105974017850690})
+	CDF97 Wavelet = cdf97{}
+	CDF53 Wavelet = cdf53{}
+)
+
+// Wavelets 所有内置小波，开启 BlindWatermarker.WaveletSearch 时提取端会依次尝试
+var Wavelets = []Wavelet{Haar, DB2, DB4, CDF97, CDF53}
+
+// WaveletByName 按名称查找内置小波，找不到时返回 nil
+func WaveletByName(name string) Wavelet {
+	for _, w := range Wavelets {
+		if w.Name() == name {
+			return w
+		}
+	}
+	return nil
+}
+
+// haar 即 dwt.go 中的 dwt1D / idwt1D
+type haar struct{}
+
+func (haar) Name() string               { return "haar" }
+func (haar) Forward(dst, src []float64) { dwt1D(dst, src) }
+func (haar) Inverse(dst, src []float64) { idwt1D(dst, src) }
+
+// daubechies 正交小波，用滤波器组实现
+// 正交滤波器没有对称性，对称延拓无法完美重建，因此边界采用周期延拓
+type daubechies struct {
+	name string
+	lo   []float64 // 低通分解滤波器 h
+	hi   []float64 // 高通分解滤波器 g[k] = (-1)^k h[len-1-k]
+}
+
+func newDaubechies(name string, lo []float64) *daubechies {
+	hi := make([]float64, len(lo))
+	for k := range lo {
+		hi[k] = lo[len(lo)-1-k]
+		if k%2 == 1 {
+			hi[k] = -hi[k]
+		}
+	}
+	return &daubechies{name: name, lo: lo, hi: hi}
+}
+
+func (d *daubechies) Name() string { return d.name }
+
+func (d *daubechies) Forward(dst, src []float64) {
+	n := len(src)
+	half := n / 2
+	for i := 0; i < half; i++ {
+		var l, h float64
+		for k := range d.lo {
+			x := src[(2*i+k)%n]
+			l += d.lo[k] * x
+			h += d.hi[k] * x
+		}
+		dst[i] = l
+		dst[half+i] = h
+	}
+}
+
+// Inverse 正交变换的逆即转置：把每个系数按滤波器“散射”回原位置
+func (d *daubechies) Inverse(dst, src []float64) {
+	n := len(src)
+	half := n / 2
+	clear(dst)
+	for i := 0; i < half; i++ {
+		l, h := src[i], src[half+i]
+		for k := range d.lo {
+			dst[(2*i+k)%n] += d.lo[k]*l + d.hi[k]*h
+		}
+	}
+}
+
+// cdf97 CDF 9/7 双正交小波 (JPEG2000 有损模式)，提升 (lifting) 实现
+// 滤波器对称，边界采用对称延拓: x[-1] = x[1], x[n] = x[n-2]
+type cdf97 struct{}
+
+const (
+	cdf97Alpha = -1.586134342059924
+	cdf97Beta  = -0.052980118572961
+	cdf97Gamma = 0.882911075530934
+	cdf97Delta = 0.443506852043971
+	cdf97K     = 1.230174104914001
+)
+
+func (cdf97) Name() string { return "cdf97" }
+
+func (cdf97) Forward(dst, src []float64) {
+	s, d := split(dst, src)
+	predict(s, d, cdf97Alpha)
+	update(s, d, cdf97Beta)
+	predict(s, d, cdf97Gamma)
+	update(s, d, cdf97Delta)
+	scale(s, Sqrt2/cdf97K)
+	scale(d, -cdf97K/Sqrt2)
+}
+
+func (cdf97) Inverse(dst, src []float64) {
+	s, d := halves(src)
+	scale(s, cdf97K/Sqrt2)
+	scale(d, -Sqrt2/cdf97K)
+	update(s, d, -cdf97Delta)
+	predict(s, d, -cdf97Gamma)
+	update(s, d, -cdf97Beta)
+	predict(s, d, -cdf97Alpha)
+	merge(dst, s, d)
+}
+
+// cdf53 CDF 5/3 (LeGall) 双正交小波 (JPEG2000 无损模式使用其整数版本)，提升实现，对称延拓
+type cdf53 struct{}
+
+func (cdf53) Name() string { return "cdf53" }
+
+func (cdf53) Forward(dst, src []float64) {
+	s, d := split(dst, src)
+	predict(s, d, -0.5)
+	update(s, d, 0.25)
+	scale(s, Sqrt2)
+	scale(d, -1/Sqrt2)
+}
+
+func (cdf53) Inverse(dst, src []float64) {
+	s, d := halves(src)
+	scale(s, 1/Sqrt2)
+	scale(d, -Sqrt2)
+	update(s, d, -0.25)
+	predict(s, d, 0.5)
+	merge(dst, s, d)
+}
+
+// 提升的小工具，s 为偶数位样本，d 为奇数位样本
+// 正变换直接在 dst 的前后两半上提升，结果自然是 [L..., H...]；逆变换在 src 上原地提升后交错写入 dst
+
+// split 把 src 的偶数位和奇数位分别放到 dst 的前后两半
+func split(dst, src []float64) (s, d []float64) {
+	s, d = halves(dst)
+	for i := range s {
+		s[i] = src[2*i]
+		d[i] = src[2*i+1]
+	}
+	return s, d
+}
+
+// halves [L..., H...] 的前后两半，不复制
+func halves(data []float64) (s, d []float64) {
+	half := len(data) / 2
+	return data[:half], data[half:]
+}
+
+// merge split 的逆操作
+func merge(dst, s, d []float64) {
+	for i := range s {
+		dst[2*i] = s[i]
+		dst[2*i+1] = d[i]
+	}
+}
+
+// predict d[i] += c * (s[i] + s[i+1])，右边界 s[half] 对称延拓为 s[half-1]
+func predict(s, d []float64, c float64) {
+	for i := range d {
+		next := s[min(i+1, len(s)-1)]
+		d[i] += c * (s[i] + next)
+	}
+}
+
+// update s[i] += c * (d[i-1] + d[i])，左边界 d[-1] 对称延拓为 d[0]
+func update(s, d []float64, c float64) {
+	for i := range s {
+		prev := d[max(i-1, 0)]
+		s[i] += c * (prev + d[i])
+	}
+}
+
+func scale(v []float64, c float64) {
+	for i := range v {
+		v[i] *= c
+	}
+}
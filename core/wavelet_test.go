@@ -0,0 +1,80 @@
+package core
+
+import (
+	"blindwatermark/internal/testimage"
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+// TestWaveletPerfectReconstruction 各小波的正变换再逆变换还原输入 (Haar 的 Sqrt2 常量只有 12 位有效数字，误差约 1e-9)
+func TestWaveletPerfectReconstruction(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 1))
+	for _, wl := range Wavelets {
+		for _, n := range []int{2, 8, 30, 256} {
+			src := make([]float64, n)
+			for i := range src {
+				src[i] = rng.Float64() * 255
+			}
+			coeffs := make([]float64, n)
+			wl.Forward(coeffs, src)
+			out := make([]float64, n)
+			wl.Inverse(out, append([]float64(nil), coeffs...))
+			for i := range src {
+				if math.Abs(out[i]-src[i]) > 1e-6 {
+					t.Fatalf("%s n=%d: sample %d is %.12f, want %.12f", wl.Name(), n, i, out[i], src[i])
+				}
+			}
+		}
+	}
+}
+
+// TestWaveletGain 各小波归一化到与正交 Haar 相同的增益：常数信号的低频、交替信号的高频都是 sqrt(2)
+func TestWaveletGain(t *testing.T) {
+	const n = 64
+	flat, alternating := make([]float64, n), make([]float64, n)
+	for i := range flat {
+		flat[i] = 1
+		alternating[i] = float64(1 - 2*(i%2))
+	}
+	out := make([]float64, n)
+	for _, wl := range Wavelets {
+		wl.Forward(out, flat)
+		if math.Abs(out[n/4]-math.Sqrt2) > 1e-9 || math.Abs(out[n/2+n/4]) > 1e-9 {
+			t.Errorf("%s: flat signal gives L %.6f, H %.6f", wl.Name(), out[n/4], out[n/2+n/4])
+		}
+		wl.Forward(out, alternating)
+		if math.Abs(math.Abs(out[n/2+n/4])-math.Sqrt2) > 1e-9 || math.Abs(out[n/4]) > 1e-9 {
+			t.Errorf("%s: alternating signal gives L %.6f, H %.6f", wl.Name(), out[n/4], out[n/2+n/4])
+		}
+	}
+}
+
+func TestWaveletByName(t *testing.T) {
+	for _, wl := range Wavelets {
+		if WaveletByName(wl.Name()) != wl {
+			t.Errorf("WaveletByName(%q) did not return the wavelet", wl.Name())
+		}
+	}
+	if WaveletByName("sym8") != nil {
+		t.Error("WaveletByName returned a wavelet for an unknown name")
+	}
+}
+
+func TestEmbedWavelets(t *testing.T) {
+	src := testimage.Photo(t, 512, 384)
+	for _, wl := range Wavelets {
+		e := &Engine{Strength: 20, Levels: 2, Wavelet: wl, Refine: 2}
+		bits := randomBits(e.Capacity(512, 384), 6)
+		marked := e.Embed(src, bits)
+		if ber := bitErrorRate(e.ExtractSoft(marked), bits); ber != 0 {
+			t.Errorf("%s: BER %.4f", wl.Name(), ber)
+		}
+		if wl != Haar {
+			haar := &Engine{Strength: 20, Levels: 2, Refine: 2}
+			if ber := bitErrorRate(haar.ExtractSoft(marked), bits); ber < 0.2 {
+				t.Errorf("%s: Haar reads it back with BER %.4f, the wavelet has no effect", wl.Name(), ber)
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Package testimage 各个包的测试共用的图片工具：示例照片、JPEG 压缩和几何变换
+package testimage
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+var (
+	photoOnce sync.Once
+	photo     image.Image
+	photoErr  error
+)
+
+// Photo 示例照片 (dist/source.png，1531x1014) 中心 w x h 的区域，复制为左上角在 (0, 0) 的 RGBA
+// 照片按本文件的位置查找，与调用方所在的目录无关
+func Photo(tb testing.TB, w, h int) *image.RGBA {
+	tb.Helper()
+	photoOnce.Do(func() {
+		_, file, _, _ := runtime.Caller(0)
+		f, err := os.Open(filepath.Join(filepath.Dir(file), "..", "..", "dist", "source.png"))
+		if err != nil {
+			photoErr = err
+			return
+		}
+		defer f.Close()
+		photo, _, photoErr = image.Decode(f)
+	})
+	if photoErr != nil {
+		tb.Fatal(photoErr)
+	}
+	b := photo.Bounds()
+	if w > b.Dx() || h > b.Dy() {
+		tb.Fatalf("test photo is %dx%d, want %dx%d", b.Dx(), b.Dy(), w, h)
+	}
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	sp := b.Min.Add(image.Pt((b.Dx()-w)/2, (b.Dy()-h)/2))
+	draw.Draw(out, out.Rect, photo, sp, draw.Src)
+	return out
+}
+
+// JPEGRoundTrip 按质量 quality 编码为 JPEG 再解码
+func JPEGRoundTrip(tb testing.TB, img image.Image, quality int) image.Image {
+	tb.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		tb.Fatal(err)
+	}
+	out, err := jpeg.Decode(&buf)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return out
+}
+
+// RotateScale 绕中心旋转 deg 度 (图片坐标，y 轴向下) 并缩放 scale 倍，画布随缩放调整、不随旋转扩大，
+// 转出画布的角落被裁掉
+func RotateScale(src image.Image, deg, scale float64) *image.RGBA {
+	b := src.Bounds()
+	w, h := int(float64(b.Dx())*scale), int(float64(b.Dy())*scale)
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	rad := deg * math.Pi / 180
+	c, s := math.Cos(rad)*scale, math.Sin(rad)*scale
+	cx, cy := float64(b.Min.X)+float64(b.Dx())/2, float64(b.Min.Y)+float64(b.Dy())/2
+	ox, oy := float64(w)/2, float64(h)/2
+	m := f64.Aff3{c, -s, ox - c*cx + s*cy, s, c, oy - s*cx - c*cy}
+	draw.CatmullRom.Transform(out, m, src, b, draw.Src, nil)
+	return out
+}
@@ -0,0 +1,117 @@
+package blindwatermark
+
+import (
+	"blindwatermark/internal/testimage"
+	"context"
+	"image"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+)
+
+// recordHandler 记录所有日志的 slog.Handler
+type recordHandler struct {
+	level   slog.Level
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordHandler) Enabled(_ context.Context, level slog.Level) bool { return level >= h.level }
+
+func (h *recordHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r)
+	return nil
+}
+
+func (h *recordHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *recordHandler) WithGroup(string) slog.Handler      { return h }
+
+// find 第一条消息为 msg 的日志
+func (h *recordHandler) find(msg string) (slog.Record, bool) {
+	for _, r := range h.records {
+		if r.Message == msg {
+			return r, true
+		}
+	}
+	return slog.Record{}, false
+}
+
+// attr 日志中名为 key 的属性
+func attr(r slog.Record, key string) (slog.Value, bool) {
+	var v slog.Value
+	found := false
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == key {
+			v, found = a.Value, true
+			return false
+		}
+		return true
+	})
+	return v, found
+}
+
+func TestLogger(t *testing.T) {
+	h := &recordHandler{level: slog.LevelDebug}
+	bw := NewBlindWatermarker(WithLogger(slog.New(h)))
+	src := testimage.Photo(t, 512, 512)
+
+	marked, err := bw.EmbedText(src, "logged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := h.find("embedding watermark")
+	if !ok {
+		t.Fatal("no debug record for embedding")
+	}
+	if v, ok := attr(r, "capacity_bits"); !ok || v.Int64() != int64(bw.capacity(src)) {
+		t.Errorf("capacity_bits = %v, want %d", v, bw.capacity(src))
+	}
+	if _, err := bw.Extract(marked); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := h.find("watermark extracted"); !ok {
+		t.Error("no debug record for extraction")
+	}
+
+	// 缩放水印图片为 Info 级别，只记录 Info 时仍然可见，Debug 被过滤
+	info := &recordHandler{level: slog.LevelInfo}
+	bw = NewBlindWatermarker(WithLogger(slog.New(info)))
+	if _, err := bw.EmbedImage(src, image.NewGray(image.Rect(0, 0, 300, 300))); err != nil {
+		t.Fatal(err)
+	}
+	r, ok = info.find("watermark image resized to fit capacity")
+	if !ok || r.Level != slog.LevelInfo {
+		t.Errorf("resize record %+v, found %v", r, ok)
+	}
+	for _, r := range info.records {
+		if r.Level < slog.LevelInfo {
+			t.Errorf("debug record %q passed an info handler", r.Message)
+		}
+	}
+}
+
+// TestLoggerSilent 未设置 Logger 时不向标准输出写任何内容
+func TestLoggerSilent(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	bw := NewBlindWatermarker()
+	src := testimage.Photo(t, 512, 512)
+	if marked, err := bw.EmbedImage(src, image.NewGray(image.Rect(0, 0, 300, 300))); err == nil {
+		bw.Extract(marked)
+	}
+	w.Close()
+	os.Stdout = stdout
+	if out, _ := io.ReadAll(r); len(out) > 0 {
+		t.Errorf("wrote to stdout without a logger: %q", out)
+	}
+}
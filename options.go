@@ -0,0 +1,144 @@
+package blindwatermark
+
+import (
+	"blindwatermark/converter"
+	"blindwatermark/core"
+	"crypto/ed25519"
+	"log/slog"
+)
+
+// Option NewBlindWatermarker 的可选设置，按传入的顺序依次应用
+// 选项本身不做检查，组合是否合理由 Validate 判断，嵌入和提取前也会检查
+type Option func(*BlindWatermarker)
+
+// WithStrength 水印强度 (系数对模式下两个系数差值的下限)，默认 20
+func WithStrength(strength float64) Option {
+	return func(b *BlindWatermarker) { b.engine.Strength = strength }
+}
+
+// WithSyncStrength 几何同步模板的幅度，默认 0 (不嵌入)，需要 ExtractResync 校正旋转 / 缩放时设为 1 左右。
+// 重采样会削弱水印，还应配合 WithLevels(2)、纠错编码和冗余嵌入，见 README
+func WithSyncStrength(amplitude float64) Option {
+	return func(b *BlindWatermarker) { b.engine.SyncStrength = amplitude }
+}
+
+// WithSubbands 嵌入使用的子带，可以按位组合，默认只用 HL
+func WithSubbands(subbands core.Subband) Option {
+	return func(b *BlindWatermarker) { b.engine.Subbands = subbands }
+}
+
+// WithLevels DWT 分解级数，默认 1 级，最多 core.MaxLevels 级；底图的宽高至少为 core.Engine.MinSize
+func WithLevels(levels int) Option {
+	return func(b *BlindWatermarker) { b.engine.Levels = levels }
+}
+
+// WithWavelet 小波基，默认 Haar
+func WithWavelet(wavelet core.Wavelet) Option {
+	return func(b *BlindWatermarker) { b.engine.Wavelet = wavelet }
+}
+
+// WithBlockSize DCT 分块边长，可选 4、8、16，默认 8
+func WithBlockSize(n int) Option {
+	return func(b *BlindWatermarker) { b.engine.BlockSize = n }
+}
+
+// WithPairs 候选的 DCT 系数对，下标须小于分块边长
+func WithPairs(pairs ...[2][2]int) Option {
+	return func(b *BlindWatermarker) { b.engine.Pairs = pairs }
+}
+
+// WithBitsPerBlock 每个 DCT 块写入的 bit 数，默认 1
+func WithBitsPerBlock(n int) Option {
+	return func(b *BlindWatermarker) { b.engine.BitsPerBlock = n }
+}
+
+// WithModulation 调制方式和 QIM / STDM 的量化步长，step 为 0 时按 JPEG 质量 75 选择
+func WithModulation(modulation core.Modulation, step float64) Option {
+	return func(b *BlindWatermarker) {
+		b.engine.Modulation = modulation
+		b.engine.Step = step
+	}
+}
+
+// WithAdaptive 按 JND 模型逐块调整强度
+func WithAdaptive(adaptive bool) Option {
+	return func(b *BlindWatermarker) { b.engine.Adaptive = adaptive }
+}
+
+// WithChroma 额外承载数据的色度通道及其强度，strength 为 0 时取 Strength 的一半
+func WithChroma(channels core.Channel, strength float64) Option {
+	return func(b *BlindWatermarker) {
+		b.engine.Chroma = channels
+		b.engine.ChromaStrength = strength
+	}
+}
+
+// WithRedundant 把数据循环平铺到全部容量上，提取时多数表决
+func WithRedundant(redundant bool) Option {
+	return func(b *BlindWatermarker) { b.engine.Redundant = redundant }
+}
+
+// WithRefine 嵌入后校验的最大轮数，默认 2
+func WithRefine(rounds int) Option {
+	return func(b *BlindWatermarker) { b.engine.Refine = rounds }
+}
+
+// WithTileSize 分块模式的分块边长 (像素)，0 表示整图处理
+func WithTileSize(size int) Option {
+	return func(b *BlindWatermarker) { b.engine.TileSize = size }
+}
+
+// WithWorkers 并发数，0 表示 runtime.GOMAXPROCS(0)
+func WithWorkers(workers int) Option {
+	return func(b *BlindWatermarker) { b.engine.Workers = workers }
+}
+
+// WithKey 决定嵌入布局的密钥，提取时需要同一个密钥
+func WithKey(key []byte) Option {
+	return func(b *BlindWatermarker) { b.engine.Key = key }
+}
+
+// WithFEC 纠错编码，例如 converter.NewReedSolomon(2) 的结果
+func WithFEC(codec converter.Codec) Option {
+	return func(b *BlindWatermarker) { b.FEC = codec }
+}
+
+// WithEncryptionKey 载荷的 AES 密钥 (16 / 24 / 32 字节)
+func WithEncryptionKey(key []byte) Option {
+	return func(b *BlindWatermarker) { b.EncryptionKey = key }
+}
+
+// WithSigningKey 载荷签名使用的 Ed25519 私钥
+func WithSigningKey(key ed25519.PrivateKey) Option {
+	return func(b *BlindWatermarker) { b.SigningKey = key }
+}
+
+// WithCompactHeader 使用紧凑头部
+func WithCompactHeader(compact bool) Option {
+	return func(b *BlindWatermarker) { b.CompactHeader = compact }
+}
+
+// WithCompress 嵌入前压缩数据
+func WithCompress(compress bool) Option {
+	return func(b *BlindWatermarker) { b.Compress = compress }
+}
+
+// WithStream 分块模式下返回按需嵌入的图片
+func WithStream(stream bool) Option {
+	return func(b *BlindWatermarker) { b.Stream = stream }
+}
+
+// WithTargetPSNR 按目标 PSNR (dB) 调整嵌入强度，只适用于系数对模式
+func WithTargetPSNR(psnr float64) Option {
+	return func(b *BlindWatermarker) { b.TargetPSNR = psnr }
+}
+
+// WithWaveletSearch 找不到水印时尝试其他内置小波
+func WithWaveletSearch(search bool) Option {
+	return func(b *BlindWatermarker) { b.WaveletSearch = search }
+}
+
+// WithLogger 诊断事件的输出，默认丢弃
+func WithLogger(logger *slog.Logger) Option {
+	return func(b *BlindWatermarker) { b.Logger = logger }
+}